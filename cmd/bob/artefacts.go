@@ -0,0 +1,226 @@
+package main
+
+// After the build pass, Bob collects the artefacts builders have declared, and writes a checksum
+// manifest of them (both `SHA256SUMS` for humans / `$ sha256sum --check` and JSON for machines).
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/function61/gokit/encoding/jsonfile"
+	"github.com/function61/gokit/os/osutil"
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/typeddigest"
+	"github.com/spf13/cobra"
+)
+
+const (
+	artefactsManifestJSONName   = "artefacts.json"
+	artefactsManifestSumsName   = "SHA256SUMS"
+	artefactsManifestDirDefault = "artefacts" // under project-specific dir
+)
+
+type ArtefactsManifest struct {
+	FriendlyRevisionID string     `json:"friendly_revision_id"`
+	Artefacts          []Artefact `json:"artefacts"`
+}
+
+type Artefact struct {
+	Path    string `json:"path"`    // relative to project root, like "rel/bob_linux-amd64"
+	Builder string `json:"builder"` // which builder produced this
+	Size    int64  `json:"size"`
+	Digest  string `json:"digest"` // typed digest, like "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592"
+}
+
+// where the manifest is written to (and read from by default)
+func artefactsManifestDir(projectName string) string {
+	return projectSpecificDir(projectName, artefactsManifestDirDefault)
+}
+
+// resolves artefact globs of builders to files and computes their digests.
+// *rootDir* is the project root.
+func collectArtefacts(rootDir string, builders []bobfile.BuilderSpec) ([]Artefact, error) {
+	withErr := func(err error) ([]Artefact, error) { return nil, fmt.Errorf("collectArtefacts: %w", err) }
+
+	artefacts := []Artefact{}
+
+	for _, builder := range builders {
+		for _, pattern := range builder.Artefacts {
+			matches, err := filepath.Glob(filepath.Join(rootDir, pattern))
+			if err != nil {
+				return withErr(err)
+			}
+
+			sort.Strings(matches) // already sorted in practice, but doc doesn't promise that
+
+			found := 0
+
+			for _, match := range matches {
+				info, err := os.Stat(match)
+				if err != nil {
+					return withErr(err)
+				}
+
+				if !info.Mode().IsRegular() { // only interested in files
+					continue
+				}
+
+				digest, err := digestFile(match, typeddigest.Sha256)
+				if err != nil {
+					return withErr(err)
+				}
+
+				relPath, err := filepath.Rel(rootDir, match)
+				if err != nil {
+					return withErr(err)
+				}
+
+				artefacts = append(artefacts, Artefact{
+					Path:    filepath.ToSlash(relPath),
+					Builder: builder.Name,
+					Size:    info.Size(),
+					Digest:  digest.String(),
+				})
+
+				found++
+			}
+
+			// most probably the build is broken or the pattern is wrong
+			if found == 0 {
+				return withErr(fmt.Errorf("%s: artefacts pattern matched no files: %s", builder.Name, pattern))
+			}
+		}
+	}
+
+	return artefacts, nil
+}
+
+func writeArtefactsManifest(dir string, manifest ArtefactsManifest) error {
+	withErr := func(err error) error { return fmt.Errorf("writeArtefactsManifest: %w", err) }
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return withErr(err)
+	}
+
+	if err := jsonfile.Write(filepath.Join(dir, artefactsManifestJSONName), manifest); err != nil {
+		return withErr(err)
+	}
+
+	sums, err := artefactsAsSha256Sums(manifest.Artefacts)
+	if err != nil {
+		return withErr(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, artefactsManifestSumsName), []byte(sums), 0644); err != nil {
+		return withErr(err)
+	}
+
+	return nil
+}
+
+// same format as `$ sha256sum` output: "<hex digest><space><space><path>"
+func artefactsAsSha256Sums(artefacts []Artefact) (string, error) {
+	lines := []string{}
+
+	for _, artefact := range artefacts {
+		digest, err := typeddigest.Parse(artefact.Digest)
+		if err != nil {
+			return "", err
+		}
+
+		lines = append(lines, fmt.Sprintf("%s  %s\n", digest.HexDigest(), artefact.Path))
+	}
+
+	return strings.Join(lines, ""), nil
+}
+
+// re-checks artefacts' digests. *rootDir* is the directory artefact paths are relative to.
+func verifyArtefacts(rootDir string, manifest ArtefactsManifest) error {
+	failed := 0
+
+	for _, artefact := range manifest.Artefacts {
+		err := func() error {
+			expected, err := typeddigest.Parse(artefact.Digest)
+			if err != nil {
+				return err
+			}
+
+			actual, err := digestFile(filepath.Join(rootDir, filepath.FromSlash(artefact.Path)), typeddigest.DigesterForAlgOf(expected))
+			if err != nil {
+				return err
+			}
+
+			if !actual.Equal(expected) {
+				return fmt.Errorf("digest mismatch: expected %s; got %s", expected.String(), actual.String())
+			}
+
+			return nil
+		}()
+		if err != nil {
+			failed++
+			fmt.Printf("%s %s: %v\n", checkMark.String(false), artefact.Path, err)
+		} else {
+			fmt.Printf("%s %s\n", checkMark.String(true), artefact.Path)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d/%d artefact(s) failed verification", failed, len(manifest.Artefacts))
+	}
+
+	return nil
+}
+
+func digestFile(path string, digester func(io.Reader) (*typeddigest.Hash, error)) (*typeddigest.Hash, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return digester(file)
+}
+
+func verifyArtefactsEntry() *cobra.Command {
+	manifestPath := ""
+	rootDir := "."
+
+	cmd := &cobra.Command{
+		Use:   "verify-artefacts",
+		Short: "Re-check artefacts' digests against the manifest written by the build",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			osutil.ExitIfError(func() error {
+				if manifestPath == "" {
+					bobfile, err := bobfile.Read()
+					if err != nil {
+						return err
+					}
+
+					manifestPath = filepath.Join(artefactsManifestDir(bobfile.ProjectName), artefactsManifestJSONName)
+				}
+
+				manifest := ArtefactsManifest{}
+				if err := jsonfile.ReadDisallowUnknownFields(manifestPath, &manifest); err != nil {
+					return err
+				}
+
+				if len(manifest.Artefacts) == 0 {
+					return errors.New("manifest has no artefacts")
+				}
+
+				return verifyArtefacts(rootDir, manifest)
+			}())
+		},
+	}
+
+	cmd.Flags().StringVarP(&manifestPath, "manifest", "m", manifestPath, "Path to "+artefactsManifestJSONName+" (default: manifest of latest build of this project)")
+	cmd.Flags().StringVarP(&rootDir, "root", "", rootDir, "Directory that artefact paths are relative to (= project root of the build)")
+
+	return cmd
+}
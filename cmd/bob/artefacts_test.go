@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+)
+
+func TestCollectAndVerifyArtefacts(t *testing.T) {
+	rootDir := t.TempDir()
+
+	assert.Ok(t, os.MkdirAll(filepath.Join(rootDir, "rel", "subdir"), 0755))
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel", "app_linux-amd64"), []byte("The quick brown fox jumps over the lazy dog"), 0644))
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel", "app_linux-arm"), []byte("hello"), 0644))
+
+	artefacts, err := collectArtefacts(rootDir, []bobfile.BuilderSpec{
+		{Name: "default", Artefacts: []string{"rel/*"}}, // "rel/subdir" is skipped
+	})
+	assert.Ok(t, err)
+
+	sums, err := artefactsAsSha256Sums(artefacts)
+	assert.Ok(t, err)
+	assert.Equal(t, sums, `d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592  rel/app_linux-amd64
+2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824  rel/app_linux-arm
+`)
+
+	manifest := ArtefactsManifest{FriendlyRevisionID: "20200219_1609_9c39d027", Artefacts: artefacts}
+
+	assert.Ok(t, verifyArtefacts(rootDir, manifest))
+
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel", "app_linux-arm"), []byte("tampered"), 0644))
+
+	assert.Equal(t, verifyArtefacts(rootDir, manifest).Error(), "1/2 artefact(s) failed verification")
+}
+
+func TestCollectArtefactsNoMatches(t *testing.T) {
+	_, err := collectArtefacts(t.TempDir(), []bobfile.BuilderSpec{
+		{Name: "default", Artefacts: []string{"rel/*"}},
+	})
+
+	assert.Equal(t, err.Error(), "collectArtefacts: default: artefacts pattern matched no files: rel/*")
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"os/exec"
 
 	"github.com/function61/gokit/encoding/jsonfile"
 	"github.com/function61/gokit/os/osutil"
@@ -52,14 +52,14 @@ func loadBaseImageConfWhenInsideContainer() (*BaseImageConfig, error) {
 	return conf, nil
 }
 
-// non-optional because the implementation makes it a bit hard to check if the file exists
-// (vs. Docker run error), and our current callsite needs non-optional anyway
-func loadNonOptionalBaseImageConf(projectName string, builder bobfile.BuilderSpec) (*BaseImageConfig, error) {
-	dockerImage := builderImageName(projectName, builder)
+// non-optional because our current callsites need non-optional anyway
+func loadNonOptionalBaseImageConf(ctx context.Context, projectName string, builder bobfile.BuilderSpec) (*BaseImageConfig, error) {
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return nil, err
+	}
 
-	// unfortunately there isn't a good high-level way to grab a file from a Docker image, so that's
-	// why we have to create a container to get it
-	content, err := exec.Command("docker", "run", "--rm", dockerImage, "cat", baseImageJSONLocation).Output()
+	content, err := containerRuntime.ReadFileFromImage(ctx, builderImageName(projectName, builder), baseImageJSONLocation)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -9,12 +10,14 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/function61/gokit/os/osutil"
 	"github.com/function61/turbobob/pkg/bobfile"
 	"github.com/function61/turbobob/pkg/versioncontrol"
 	ociv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 )
 
@@ -25,6 +28,8 @@ type BuildContext struct {
 	PublishArtefacts  bool
 	CloningStepNeeded bool // false in CI, true in local (unless uncommited build requested)
 	BuilderNameFilter string
+	AffectedBuilders  map[string]bool // nil if not using change detection (= all builders are affected)
+	AffectedImages    map[string]bool // nil if not using change detection (= all images are affected)
 	ENVsAreRequired   bool
 	VersionControl    versioncontrol.Interface
 	RevisionID        *versioncontrol.RevisionID
@@ -34,7 +39,38 @@ type BuildContext struct {
 	IsDefaultBranch   bool   // whether we are in "main" / "master" or equivalent branch
 }
 
-func runBuilder(builder bobfile.BuilderSpec, buildCtx *BuildContext, opDesc string, cmdToRun []string) error {
+// whether the builder is part of this build (not filtered out by name or change detection)
+func (b *BuildContext) BuilderSelected(name string) bool {
+	if b.BuilderNameFilter != "" && name != b.BuilderNameFilter {
+		return false
+	}
+
+	if b.AffectedBuilders != nil && !b.AffectedBuilders[name] {
+		return false
+	}
+
+	return true
+}
+
+// building only one builder by name => skip steps that concern the whole project.
+// (change detection is not a partial build: it knows which images are affected.)
+func (b *BuildContext) PartialBuild() bool {
+	return b.BuilderNameFilter != ""
+}
+
+func (b *BuildContext) DockerImageSelected(image string) bool {
+	if b.PartialBuild() {
+		return false
+	}
+
+	if b.AffectedImages != nil && !b.AffectedImages[image] {
+		return false
+	}
+
+	return true
+}
+
+func runBuilder(ctx context.Context, builder bobfile.BuilderSpec, buildCtx *BuildContext, opDesc string, cmdToRun []string) error {
 	wd, errWd := os.Getwd()
 	if errWd != nil {
 		return errWd
@@ -42,12 +78,31 @@ func runBuilder(builder bobfile.BuilderSpec, buildCtx *BuildContext, opDesc stri
 
 	builderNameOpDesc := fmt.Sprintf("%s/%s", builder.Name, opDesc)
 
+	// other builders can be running at the same time
+	concurrent := buildCtx.Bobfile.Experiments.ParallelBuilders
+
+	output := newBuilderOutput(builderNameOpDesc, concurrent)
+
+	pullProgress := io.Writer(os.Stdout)
+	if concurrent {
+		pullProgress = newLineSplitterTee(io.Discard, output.Line)
+	}
+
+	logLineGroup := func(group string, work func() error) error {
+		if !concurrent {
+			return withLogLineGroup(group, work)
+		}
+
+		// log line groups from concurrent builders would interleave, so we can't use them
+		output.Line("====== " + group)
+		return work()
+	}
+
 	switch must(parseBuilderUsesType(builder.Uses)) {
 	case builderUsesTypeImage:
-		// the "$ docker run ..." later would do an implicit pull, but let's do an explicit pull
-		// here in order to nicely put the download progress output in its own log line group
-		if err := withLogLineGroup(fmt.Sprintf("%s > pull", builderNameOpDesc), func() error {
-			return dockerPullIfRequired(builderImageName(buildCtx.Bobfile.ProjectName, builder))
+		// pull explicitly in order to nicely put the download progress output in its own log line group
+		if err := logLineGroup(fmt.Sprintf("%s > pull", builderNameOpDesc), func() error {
+			return dockerPullIfRequired(ctx, builderImageName(buildCtx.Bobfile.ProjectName, builder), pullProgress)
 		}); err != nil {
 			return err
 		}
@@ -60,33 +115,24 @@ func runBuilder(builder bobfile.BuilderSpec, buildCtx *BuildContext, opDesc stri
 	// empty work just to emit a "starting" log group. this log group is important because if the
 	// command-to-run itself doesn't create log groups (to which we could insert script name), then
 	// script name won't be visible at all in none of the group names
-	_ = withLogLineGroup(fmt.Sprintf("%s > starting %s", builderNameOpDesc, builderCommandToHumanReadable(cmdToRun)), func() error { return nil })
+	_ = logLineGroup(fmt.Sprintf("%s > starting %s", builderNameOpDesc, builderCommandToHumanReadable(cmdToRun)), func() error { return nil })
 
-	buildArgs := []string{
-		"docker",
-		"run",
-		"--rm",
-		"--tty",
-		"--entrypoint=", // turn off possible "arg mode" in base image (our cmd would just be args to entrypoint)
-		"--volume", wd + "/" + builder.MountSource + ":" + builder.MountDestination,
-		"--volume", "/tmp/build:/tmp/build", // cannot map to /tmp because at least apt won't work (permission issues?)
+	binds := []string{
+		wd + "/" + builder.MountSource + ":" + builder.MountDestination,
+		"/tmp/build:/tmp/build", // cannot map to /tmp because at least apt won't work (permission issues?)
 	}
 
-	baseImageConf, err := loadNonOptionalBaseImageConf(buildCtx.Bobfile.ProjectName, builder)
+	baseImageConf, err := loadNonOptionalBaseImageConf(ctx, buildCtx.Bobfile.ProjectName, builder)
 	if err == nil { // it's optional here. used to mount the cache directories
 		for _, pathContainer := range baseImageConf.PathsToCache {
 			pathHostSide, err := makeCachePathHostSide(pathContainer)
 			if err != nil {
 				return err
 			}
-			buildArgs = append(buildArgs, fmt.Sprintf("--mount=type=bind,source=%s,destination=%s", pathHostSide, pathContainer))
+			binds = append(binds, pathHostSide+":"+pathContainer)
 		}
 	}
 
-	if builder.Workdir != "" {
-		buildArgs = append(buildArgs, "--workdir", builder.Workdir)
-	}
-
 	archesToBuildFor := *buildCtx.Bobfile.OsArches
 
 	if buildCtx.FastBuild {
@@ -94,60 +140,108 @@ func runBuilder(builder bobfile.BuilderSpec, buildCtx *BuildContext, opDesc stri
 		archesToBuildFor = buildArchOnlyForCurrentlyRunningArch(archesToBuildFor)
 	}
 
-	// inserts ["--env", "FOO"] pairs for each PassEnvs
-	buildArgs, errEnv := dockerRelayEnvVars(
-		buildArgs,
+	envs, err := builderContainerEnvs(
 		buildCtx.RevisionID,
 		builder,
 		buildCtx.ENVsAreRequired,
 		archesToBuildFor,
 		buildCtx.FastBuild,
 		buildCtx.Debug)
-	if errEnv != nil {
-		return errEnv
+	if err != nil {
+		return err
 	}
 
-	buildArgs = append(buildArgs, builderImageName(buildCtx.Bobfile.ProjectName, builder))
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return err
+	}
 
-	if len(cmdToRun) > 0 {
-		buildArgs = append(buildArgs, cmdToRun...)
+	// remote runtime would bind mount (an empty directory at) the path from its own filesystem
+	if len(builder.SecretFiles) > 0 && containerRuntime.Remote() {
+		return fmt.Errorf("%s: secret_files need the container runtime on this machine (DOCKER_HOST=%s)", builder.Name, os.Getenv("DOCKER_HOST"))
 	}
 
-	//nolint:gosec // ok
-	buildCmd := exec.Command(buildArgs[0], buildArgs[1:]...)
-	buildCmd.Stdout = newLineSplitterTee(io.Discard, func(line string) {
-		lineMaybeModified := func() string {
-			// for each log line group, add "breadcrumb prefix" of builder / operation description.
-			// example group name: "staticAnalysis" => "default/build > staticAnalysis"
-			if strings.HasPrefix(line, "::group::") {
-				originalGroupName := line[len("::group::"):]
-
-				return fmt.Sprintf("::group::%s > %s", builderNameOpDesc, originalGroupName)
-			} else {
-				return line // as-is
-			}
-		}()
+	secretFilesOwnerUID := 0
+	if len(builder.SecretFiles) > 0 {
+		builderImage, err := containerRuntime.ImageInspect(ctx, builderImageName(buildCtx.Bobfile.ProjectName, builder))
+		if err != nil {
+			return err
+		}
 
-		_, _ = os.Stdout.Write([]byte(lineMaybeModified + "\n")) // need to add newline back
-	})
-	buildCmd.Stderr = os.Stderr
+		secretFilesOwnerUID, err = imageUserID(builderImage, func() ([]byte, error) {
+			return containerRuntime.ReadFileFromImage(ctx, builderImageName(buildCtx.Bobfile.ProjectName, builder), "/etc/passwd")
+		})
+		if err != nil {
+			return fmt.Errorf("%s: secret_files: %w", builder.Name, err)
+		}
+	}
 
-	if err := buildCmd.Run(); err != nil {
+	secretFileBinds, cleanupSecretFiles, err := materializeSecretFiles(builder.SecretFiles, secretFilesTmpfsDir, secretFilesOwnerUID)
+	if err != nil {
 		return err
 	}
+	// runs also on failure and interrupt (canceled ctx), after the container has been removed
+	defer cleanupSecretFiles()
 
-	return nil
+	binds = append(binds, secretFileBinds...)
+
+	secrets := newSecretMasker(builderSecretValues(builder))
+	for _, name := range secrets.NotMasked() {
+		log.Printf("WARN: %s: secret %s (or some of its lines) is shorter than %d characters, so it's not masked from output", builder.Name, name, secretMaskMinLength)
+	}
+
+	containerOutput := newLineSplitterTee(io.Discard, func(line string) {
+		line = secrets.Mask(line)
+
+		switch {
+		case strings.HasPrefix(line, "::group::"):
+			originalGroupName := line[len("::group::"):]
+
+			if concurrent {
+				output.Line("====== " + originalGroupName)
+			} else {
+				// for each log line group, add "breadcrumb prefix" of builder / operation description.
+				// example group name: "staticAnalysis" => "default/build > staticAnalysis"
+				output.Line(fmt.Sprintf("::group::%s > %s", builderNameOpDesc, originalGroupName))
+			}
+		case line == "::endgroup::" && concurrent:
+			// drop
+		default:
+			output.Line(line) // as-is
+		}
+	})
+
+	return containerRuntime.RunContainer(ctx, containerRunSpec{
+		// named so it's recognizable in e.g. `$ docker ps`
+		Name:    fmt.Sprintf("tbbuild-%s-%s-%d", buildCtx.Bobfile.ProjectName, builder.Name, os.Getpid()),
+		Image:   builderImageName(buildCtx.Bobfile.ProjectName, builder),
+		Command: cmdToRun,
+		Env:     envs,
+		Binds:   binds,
+		Workdir: builder.Workdir,
+	}, containerOutput)
 }
 
 type imageBuildOutput struct {
-	tag string
+	tag          string
+	tags         []string // all tags the image was tagged with (including `tag`)
+	digest       string   // "sha256:..."
+	platforms    []string // empty if built only for currently running platform
+	pushed       bool
+	attestations []string // "sbom" | "provenance"
+	signature    string   // ref of cosign signature, like "fn61/turbobob:sha256-....sig"
 }
 
-func buildAndPushOneDockerImage(dockerImage bobfile.DockerImageSpec, buildCtx *BuildContext) (*imageBuildOutput, error) {
+func buildAndPushOneDockerImage(ctx context.Context, dockerImage bobfile.DockerImageSpec, buildCtx *BuildContext) (*imageBuildOutput, error) {
 	withErr := func(err error) (*imageBuildOutput, error) {
 		return nil, fmt.Errorf("buildAndPushOneDockerImage: %w", err)
 	}
 
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return withErr(err)
+	}
+
 	tagWithoutVersion := dockerImage.Image
 	tag := tagWithoutVersion + ":" + buildCtx.RevisionID.FriendlyRevisionID
 	tagLatest := tagWithoutVersion + ":latest"
@@ -159,16 +253,6 @@ func buildAndPushOneDockerImage(dockerImage bobfile.DockerImageSpec, buildCtx *B
 
 	annotationsKeyValues := []string{} // items look like "title=foobar"
 
-	// annotationsAs("--annotation=") => ["--annotation=title=foobar"]
-	annotationsAs := func(argPrefix string) []string {
-		argified := []string{}
-		for _, annotation := range annotationsKeyValues {
-			// "title=foobar" => "--annotation=title=foobar"
-			argified = append(argified, argPrefix+annotation)
-		}
-		return argified
-	}
-
 	annotate := func(key string, value string) {
 		if value == "" {
 			return
@@ -197,57 +281,78 @@ func buildAndPushOneDockerImage(dockerImage bobfile.DockerImageSpec, buildCtx *B
 
 	printHeading(fmt.Sprintf("Building %s", tag))
 
-	// TODO: if in CI, install buildx automatically if needed?
-
-	args := []string{
-		"docker",
-		"buildx",
-		"build",
-		"--file", dockerfilePath,
-		"--tag=" + tag,
-	}
-
 	platformsToBuildFor := func() []string {
 		if buildCtx.FastBuild {
-			return nil // don't specify platform explicitly => Docker assumes currently running platform
+			return nil // don't specify platform explicitly => runtime assumes currently running platform
 		} else {
 			return dockerImage.Platforms
 		}
 	}()
 
-	for _, platformToBuildFor := range platformsToBuildFor {
-		args = append(args, "--platform="+platformToBuildFor)
-	}
-
-	// https://docs.docker.com/reference/cli/docker/buildx/build/#annotation
-	// annotate both the image index and the image manifest.
-	// if we don't specify type of annotation, only the image manifest is annotated.
-	// for example GitHub packages UI only shows annotations from OCI image index.
-	args = append(args, annotationsAs("--annotation=index,manifest:")...)
-
-	// for backwards compatibility (some consumers use this), publish the annotations also as labels
-	args = append(args, annotationsAs("--label=")...)
+	tags := []string{tag}
 
 	if shouldTagLatest {
-		args = append(args, "--tag="+tagLatest)
+		tags = append(tags, tagLatest)
 	}
 
-	args = append(args, buildContextDir)
+	additionalTags, err := expandImageTagTemplates(dockerImage.Tags, imageTagTemplateData(buildCtx.RevisionID))
+	if err != nil {
+		return withErr(err)
+	}
+
+	for _, additionalTag := range additionalTags {
+		if tagged := tagWithoutVersion + ":" + additionalTag; !lo.Contains(tags, tagged) {
+			tags = append(tags, tagged)
+		}
+	}
 
+	// attestations can't be stored in the local image store, so they only make sense when pushing
+	sbom := dockerImage.SBOM && buildCtx.PublishArtefacts
+	provenance := ""
 	if buildCtx.PublishArtefacts {
-		// the build command has integrated push support. we'd actually prefer to separate
-		// these stages, but multi-arch manifests aren't supported storing locally so we've
-		// to push immediately
-		args = append(args, "--push")
+		provenance = dockerImage.Provenance
 	}
 
-	//nolint:gosec // ok
-	if err := passthroughStdoutAndStderr(exec.Command(args[0], args[1:]...)).Run(); err != nil {
+	attestations := []string{}
+	if sbom {
+		attestations = append(attestations, "sbom")
+	}
+	if provenance != "" {
+		attestations = append(attestations, "provenance")
+	}
+
+	digest, err := containerRuntime.BuildAndPushImage(ctx, imageBuildSpec{
+		DockerfilePath: dockerfilePath,
+		ContextDir:     buildContextDir,
+		Tags:           tags,
+		Platforms:      platformsToBuildFor,
+		Annotations:    annotationsKeyValues,
+		SBOM:           sbom,
+		Provenance:     provenance,
+		Push:           buildCtx.PublishArtefacts,
+	}, os.Stdout)
+	if err != nil {
 		return withErr(err)
 	}
 
+	signature := ""
+	if dockerImage.Sign != nil && buildCtx.PublishArtefacts {
+		printHeading(fmt.Sprintf("Signing %s@%s", tagWithoutVersion, digest))
+
+		signature, err = signImage(ctx, execCLI, tagWithoutVersion, digest, dockerImage.Sign.Key, os.Stdout)
+		if err != nil {
+			return withErr(err)
+		}
+	}
+
 	return &imageBuildOutput{
-		tag: tag,
+		tag:          tag,
+		tags:         tags,
+		digest:       digest,
+		platforms:    platformsToBuildFor,
+		pushed:       buildCtx.PublishArtefacts,
+		attestations: attestations,
+		signature:    signature,
 	}, nil
 }
 
@@ -306,12 +411,42 @@ func cloneToWorkdir(buildCtx *BuildContext) error {
 	return nil
 }
 
+type builderPassOutput struct {
+	builder  string
+	pass     string // "prepare" | "build" | "publish"
+	duration time.Duration
+	exitCode int
+	cached   bool // result was restored from build cache instead of running the pass
+	err      error
+}
+
 type buildOutput struct {
-	images []imageBuildOutput
+	images           []imageBuildOutput
+	artefacts        []Artefact
+	githubReleaseURL string // empty if not published to GitHub release
+	passes           []builderPassOutput
+	builderImages    map[string]string // builder name => image digest of the builder
+	passesMu         sync.Mutex        // passes can be recorded concurrently
+	builderImageMu   sync.Mutex
 }
 
-func build(buildCtx *BuildContext) (*buildOutput, error) {
-	withErr := func(err error) (*buildOutput, error) { return nil, fmt.Errorf("build: %w", err) }
+func (b *buildOutput) recordPass(pass builderPassOutput) {
+	b.passesMu.Lock()
+	defer b.passesMu.Unlock()
+
+	b.passes = append(b.passes, pass)
+}
+
+// output is returned (as partial) even on error, so the failed build can be reported
+func build(ctx context.Context, buildCtx *BuildContext) (*buildOutput, error) {
+	output := &buildOutput{
+		images:        []imageBuildOutput{},
+		artefacts:     []Artefact{},
+		passes:        []builderPassOutput{},
+		builderImages: map[string]string{},
+	}
+
+	withErr := func(err error) (*buildOutput, error) { return output, fmt.Errorf("build: %w", err) }
 
 	if buildCtx.CloningStepNeeded {
 		if err := cloneToWorkdir(buildCtx); err != nil {
@@ -325,13 +460,17 @@ func build(buildCtx *BuildContext) (*buildOutput, error) {
 		}
 	}
 
+	cache := newBuildCache(buildCtx.Bobfile.ProjectName)
+
+	dependencies := builderDependencies(buildCtx.Bobfile.Builders)
+
 	// build builders.
 	//
 	// it would be cool to not invoke Docker if this is cached anyway, but the analysis would have
 	// to include modification check for the Dockerfile and all of its build context, so we're just
 	// best off calling Docker build because it is the best at detecting cache invalidation.
 	for _, builder := range buildCtx.Bobfile.Builders {
-		if buildCtx.BuilderNameFilter != "" && builder.Name != buildCtx.BuilderNameFilter {
+		if !buildCtx.BuilderSelected(builder.Name) {
 			continue
 		}
 
@@ -345,29 +484,70 @@ func build(buildCtx *BuildContext) (*buildOutput, error) {
 			continue
 		}
 
-		if err := buildBuilder(buildCtx.Bobfile, &builder); err != nil {
+		if err := buildBuilder(ctx, buildCtx.Bobfile, &builder); err != nil {
 			return withErr(err)
 		}
 	}
 
 	// three-pass process. the flow is well documented in *BuilderCommands* type
 	pass := func(opDesc string, getCommand func(cmds bobfile.BuilderCommands) []string) error {
+		buildersInPass := []bobfile.BuilderSpec{}
+
 		for _, builder := range buildCtx.Bobfile.Builders {
-			if buildCtx.BuilderNameFilter != "" && builder.Name != buildCtx.BuilderNameFilter {
+			if !buildCtx.BuilderSelected(builder.Name) {
 				continue
 			}
 
-			cmd := getCommand(builder.Commands)
-			if len(cmd) == 0 { // no command for this step specified
+			if len(getCommand(builder.Commands)) == 0 { // no command for this step specified
 				continue
 			}
 
-			if err := runBuilder(builder, buildCtx, opDesc, cmd); err != nil {
+			buildersInPass = append(buildersInPass, builder)
+		}
+
+		work := func(ctx context.Context, builder bobfile.BuilderSpec) error {
+			started := time.Now()
+
+			runPass := func() error {
+				return runBuilder(ctx, builder, buildCtx, opDesc, getCommand(builder.Commands))
+			}
+
+			var err error
+			cached := false
+			if opDesc == "build" { // only build pass' results are cacheable
+				cached, err = buildPassWithCache(ctx, buildCtx, builder, cache, runPass)
+			} else {
+				err = runPass()
+			}
+
+			output.recordPass(builderPassOutput{
+				builder:  builder.Name,
+				pass:     opDesc,
+				duration: time.Since(started),
+				exitCode: exitCodeFromErr(err),
+				cached:   cached,
+				err:      err,
+			})
+
+			// the builder's image was pulled or built by now
+			if digest, errDigest := dockerImageDigest(ctx, builderImageName(buildCtx.Bobfile.ProjectName, builder)); errDigest == nil {
+				output.builderImageMu.Lock()
+				output.builderImages[builder.Name] = digest
+				output.builderImageMu.Unlock()
+			}
+
+			if err != nil {
 				return fmt.Errorf("%s.%s: %w", builder.Name, opDesc, err)
 			}
+
+			return nil
 		}
 
-		return nil
+		if !buildCtx.Bobfile.Experiments.ParallelBuilders {
+			return runBuildersSequentially(ctx, buildersInPass, work)
+		}
+
+		return runBuildersInDependencyOrder(ctx, buildersInPass, dependencies, work)
 	}
 
 	preparePass := func(cmds bobfile.BuilderCommands) []string { return cmds.Prepare }
@@ -382,30 +562,39 @@ func build(buildCtx *BuildContext) (*buildOutput, error) {
 		return withErr(err) // err context ok
 	}
 
+	if err := collectArtefactsAndWriteManifest(buildCtx, output); err != nil {
+		return withErr(err)
+	}
+
 	if buildCtx.PublishArtefacts {
 		if err := pass("publish", publishPass); err != nil {
 			return withErr(err) // err context ok
 		}
-	}
 
-	dockerLoginCache := newDockerRegistryLoginCache()
+		// with change detection there's nothing to release if no builder with artefacts was affected
+		nothingToRelease := buildCtx.AffectedBuilders != nil && len(output.artefacts) == 0
 
-	output := buildOutput{
-		images: []imageBuildOutput{},
+		if buildCtx.Bobfile.GitHubRelease != nil && !buildCtx.PartialBuild() && !nothingToRelease {
+			if err := publishArtefactsToGithubRelease(ctx, buildCtx, output); err != nil {
+				return withErr(err)
+			}
+		}
 	}
 
+	dockerLoginCache := newDockerRegistryLoginCache()
+
 	for _, dockerImage := range buildCtx.Bobfile.DockerImages {
-		if buildCtx.BuilderNameFilter != "" {
-			continue // when building a specifified builder => skip everything else
+		if !buildCtx.DockerImageSelected(dockerImage.Image) {
+			continue
 		}
 
 		if buildCtx.PublishArtefacts {
-			if err := loginToDockerRegistry(dockerImage, dockerLoginCache); err != nil {
+			if err := loginToDockerRegistry(ctx, dockerImage, dockerLoginCache); err != nil {
 				return withErr(err)
 			}
 		}
 
-		imageOutput, err := buildAndPushOneDockerImage(dockerImage, buildCtx)
+		imageOutput, err := buildAndPushOneDockerImage(ctx, dockerImage, buildCtx)
 		if err != nil {
 			return withErr(err)
 		}
@@ -413,7 +602,73 @@ func build(buildCtx *BuildContext) (*buildOutput, error) {
 		output.images = append(output.images, *imageOutput)
 	}
 
-	return &output, nil
+	return output, nil
+}
+
+func collectArtefactsAndWriteManifest(buildCtx *BuildContext, output *buildOutput) error {
+	builders := []bobfile.BuilderSpec{}
+	for _, builder := range buildCtx.Bobfile.Builders {
+		if !buildCtx.BuilderSelected(builder.Name) {
+			continue
+		}
+
+		if len(builder.Artefacts) > 0 {
+			builders = append(builders, builder)
+		}
+	}
+
+	if len(builders) == 0 {
+		return nil
+	}
+
+	artefacts, err := collectArtefacts(buildCtx.WorkspaceDir, builders)
+	if err != nil {
+		return err
+	}
+
+	output.artefacts = artefacts
+
+	manifestDir := artefactsManifestDir(buildCtx.Bobfile.ProjectName)
+
+	printHeading(fmt.Sprintf("Collected %d artefact(s), manifest in %s", len(artefacts), manifestDir))
+
+	return writeArtefactsManifest(manifestDir, ArtefactsManifest{
+		FriendlyRevisionID: buildCtx.RevisionID.FriendlyRevisionID,
+		Artefacts:          artefacts,
+	})
+}
+
+func publishArtefactsToGithubRelease(ctx context.Context, buildCtx *BuildContext, output *buildOutput) error {
+	if len(output.artefacts) == 0 {
+		return errors.New("github_release specified but no builder declares artefacts")
+	}
+
+	client, err := newGithubReleasesClientFromEnv(buildCtx.Bobfile.GitHubRelease.Repository)
+	if err != nil {
+		return err
+	}
+
+	files, err := githubReleaseAssetFiles(buildCtx.WorkspaceDir, output.artefacts, artefactsManifestDir(buildCtx.Bobfile.ProjectName))
+	if err != nil {
+		return err
+	}
+
+	printHeading(fmt.Sprintf("Publishing %d file(s) to GitHub release %s", len(files), buildCtx.RevisionID.FriendlyRevisionID))
+
+	releaseURL, err := publishToGithubRelease(
+		ctx,
+		client,
+		buildCtx.RevisionID.FriendlyRevisionID,
+		buildCtx.RevisionID.RevisionID,
+		buildCtx.Bobfile.GitHubRelease.Prerelease,
+		files)
+	if err != nil {
+		return err
+	}
+
+	output.githubReleaseURL = releaseURL
+
+	return nil
 }
 
 func constructBuildContext(
@@ -463,6 +718,7 @@ func constructBuildContext(
 		ENVsAreRequired:   envsAreRequired,
 		VersionControl:    versionControl,
 		FastBuild:         fastBuild,
+		IsDefaultBranch:   metadata.IsDefaultBranch(), // CI settings override, as CI checkouts are usually detached
 	}
 
 	return buildCtx, nil
@@ -478,6 +734,10 @@ func buildEntry() *cobra.Command {
 	builderName := ""
 	norequireEnvs := false
 	fastbuild := false
+	reportPath := ""
+	ciReportPath := ""
+	changedSince := ""
+	ciChangedSince := ""
 
 	cmd := &cobra.Command{
 		Use:   "build",
@@ -495,77 +755,86 @@ func buildEntry() *cobra.Command {
 				areWeInCi)
 			osutil.ExitIfError(err)
 
-			_, err = build(buildCtx)
+			if changedSince != "" {
+				osutil.ExitIfError(restrictToBuildersChangedSince(buildCtx, changedSince, !uncommitted))
+			}
+
+			output, err := build(osutil.CancelOnInterruptOrTerminate(nil), buildCtx)
+
+			if reportPath != "" {
+				if errReport := writeBuildReport(reportPath, buildCtx, output, err); errReport != nil {
+					log.Printf("WARN: %v", errReport)
+				}
+			}
+
 			osutil.ExitIfError(err)
 		},
 	}
 
-	cmd.AddCommand(&cobra.Command{
+	inCIAutodetectSettingsCmd := &cobra.Command{
 		Use:   "in-ci-autodetect-settings",
 		Short: "Run build in CI, autodetect build info (like if building for a pull request) from its ENV variables",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
 			osutil.ExitIfError(func() error {
-				if !runningInGitHubActions() {
-					return errors.New("expecting GITHUB_ACTIONS=true")
+				ciProvider := currentCIProvider()
+				if ciProvider == nil {
+					return errors.New("unable to detect CI system (supported: GitHub Actions, Gitea/Forgejo Actions, GitLab CI, Drone, Jenkins)")
 				}
 
-				publishArtefacts, err := func() (bool, error) {
-					event := os.Getenv("GITHUB_EVENT_NAME")
-					switch event {
-					case "push":
-						return true, nil
-					case "pull_request": // PRs don't publish artefacts
-						return false, nil
-					default:
-						return false, fmt.Errorf("unsupported event: %s", event)
-					}
-				}()
+				settings, err := ciProvider.BuildSettings()
 				if err != nil {
-					return err
+					return fmt.Errorf("%s: %w", ciProvider.Name(), err)
 				}
 
-				buildCtx, err := constructBuildContext(publishArtefacts, true, "", false, false, true)
+				buildCtx, err := constructBuildContext(settings.PublishArtefacts, true, "", false, false, true)
 				if err != nil {
 					return err
 				}
 
-				if ownerAndRepo := os.Getenv("GITHUB_REPOSITORY"); ownerAndRepo != "" {
-					// "function61/turbobob" => "https://github.com/function61/turbobob"
-					buildCtx.RepositoryURL = fmt.Sprintf("%s/%s", os.Getenv("GITHUB_SERVER_URL"), ownerAndRepo)
-				}
+				buildCtx.RepositoryURL = settings.RepositoryURL
+				buildCtx.IsDefaultBranch = settings.IsDefaultBranch
+				buildCtx.Debug = settings.Debug
 
-				// not automatically available as ENV variable (it only exists as a workflow variable `github.event.repository.default_branch` which you'd have to pass to ENV)
-				defaultBranchName := firstNonEmpty(os.Getenv("DEFAULT_BRANCH_NAME"), "main")
-				if defaultBranchName == os.Getenv("GITHUB_REF_NAME") {
-					buildCtx.IsDefaultBranch = true
+				if ciChangedSince != "" {
+					if err := restrictToBuildersChangedSince(buildCtx, ciChangedSince, true); err != nil {
+						return err
+					}
 				}
 
-				if os.Getenv("RUNNER_DEBUG") == "1" {
-					buildCtx.Debug = true
+				output, err := build(osutil.CancelOnInterruptOrTerminate(nil), buildCtx)
+
+				if ciReportPath != "" {
+					if errReport := writeBuildReport(ciReportPath, buildCtx, output, err); errReport != nil {
+						fmt.Println(ciProvider.Annotation(annotationLevelWarning, errReport.Error()))
+					}
 				}
 
-				output, err := build(buildCtx)
 				if err != nil {
-					return err
+					// the annotation is our error message, so not returning it for ExitIfError() to print again
+					fmt.Println(ciProvider.Annotation(annotationLevelError, err.Error()))
+					os.Exit(1)
 				}
 
-				// https://github.blog/news-insights/product-news/supercharging-github-actions-with-job-summaries/
-				if stepSummaryFilename := os.Getenv("GITHUB_STEP_SUMMARY"); stepSummaryFilename != "" && len(output.images) > 0 {
-					if err := githubStepSummaryWriteImages(stepSummaryFilename, output.images); err != nil {
-						log.Printf("WARN: %v", err)
-					}
+				if err := ciProvider.WriteBuildSummary(output); err != nil {
+					fmt.Println(ciProvider.Annotation(annotationLevelWarning, err.Error()))
 				}
 
 				return nil
 			}())
 		},
-	})
+	}
+	inCIAutodetectSettingsCmd.Flags().StringVarP(&ciReportPath, "report", "", ciReportPath, "Write machine-readable build report (JSON) to this path")
+	inCIAutodetectSettingsCmd.Flags().StringVarP(&ciChangedSince, "changed-since", "", ciChangedSince, "Build only builders affected by changes since this revision")
+	cmd.AddCommand(inCIAutodetectSettingsCmd)
+
 	cmd.Flags().BoolVarP(&norequireEnvs, "norequire-envs", "n", norequireEnvs, "Don´t error out if not all ENV vars are set")
 	cmd.Flags().BoolVarP(&publishArtefacts, "publish-artefacts", "p", publishArtefacts, "Whether to publish the artefacts")
 	cmd.Flags().BoolVarP(&uncommitted, "uncommitted", "u", uncommitted, "Include uncommitted changes")
 	cmd.Flags().BoolVarP(&fastbuild, "fast", "f", fastbuild, "Skip non-essential steps (linting, testing etc.)")
 	cmd.Flags().StringVarP(&builderName, "builder", "b", builderName, "If specified, runs only one builder instead of all")
+	cmd.Flags().StringVarP(&reportPath, "report", "", reportPath, "Write machine-readable build report (JSON) to this path")
+	cmd.Flags().StringVarP(&changedSince, "changed-since", "", changedSince, "Build only builders affected by changes since this revision (like \"origin/main\")")
 
 	return cmd
 }
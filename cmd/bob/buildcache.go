@@ -0,0 +1,378 @@
+package main
+
+// Opt-in caching of build pass results. A builder that declares `cache_inputs` gets a cache key
+// computed from its inputs (files, builder image, ENV and command). If a previous successful
+// build pass with the same key exists, the builder's build pass is skipped and its declared
+// artefacts are restored from the cache.
+//
+// NOTE: revision IDs are purposefully not part of the key (they change on every commit, which would
+// defeat caching), so restored artefacts carry the revision of the build that produced them. That's
+// why publishing builds don't use cached results (but do store theirs).
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/function61/gokit/encoding/jsonfile"
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/typeddigest"
+)
+
+const (
+	buildCacheEntryJSONName = "entry.json"
+	buildCacheFilesDirName  = "files"
+)
+
+// everything that affects the result of a build pass. hashed to produce the cache key.
+type buildCacheKeyMaterial struct {
+	Builder string   `json:"builder"`
+	ImageID string   `json:"image_id"`
+	Command []string `json:"command"`
+	Env     []string `json:"env"`    // sorted "KEY=value" pairs
+	Inputs  []string `json:"inputs"` // "<hex digest>  <path>" (like `$ sha256sum` output), sorted by path
+}
+
+type buildCacheEntry struct {
+	Key       string     `json:"key"` // typed digest
+	Builder   string     `json:"builder"`
+	CreatedAt time.Time  `json:"created_at"`
+	Outputs   []Artefact `json:"outputs"` // builder's artefacts, stored under the entry's files dir
+}
+
+func buildCacheKey(material buildCacheKeyMaterial) (*typeddigest.Hash, error) {
+	materialJSON, err := json.Marshal(material)
+	if err != nil {
+		return nil, err
+	}
+
+	return typeddigest.Sha256(bytes.NewReader(materialJSON))
+}
+
+// resolves input globs to files. directories are matched recursively.
+// *rootDir* is the project root.
+func buildCacheInputs(rootDir string, patterns []string) ([]string, error) {
+	withErr := func(err error) ([]string, error) { return nil, fmt.Errorf("buildCacheInputs: %w", err) }
+
+	digestByPath := map[string]string{} // patterns can overlap
+
+	addFile := func(path string) error {
+		relPath, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			return err
+		}
+
+		digest, err := digestFile(path, typeddigest.Sha256)
+		if err != nil {
+			return err
+		}
+
+		digestByPath[filepath.ToSlash(relPath)] = digest.HexDigest()
+		return nil
+	}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(filepath.Join(rootDir, pattern))
+		if err != nil {
+			return withErr(err)
+		}
+
+		// a typo would make us miss changes and use stale results
+		if len(matches) == 0 {
+			return withErr(fmt.Errorf("cache_inputs pattern matched no files: %s", pattern))
+		}
+
+		for _, match := range matches {
+			if err := filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+
+				if !entry.Type().IsRegular() { // dirs are walked into. symlinks etc. are skipped
+					return nil
+				}
+
+				return addFile(path)
+			}); err != nil {
+				return withErr(err)
+			}
+		}
+	}
+
+	paths := []string{}
+	for path := range digestByPath {
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+
+	inputs := []string{}
+	for _, path := range paths {
+		inputs = append(inputs, fmt.Sprintf("%s  %s", digestByPath[path], path))
+	}
+
+	return inputs, nil
+}
+
+// ENV that affects the build (= what's passed to the build container, except revision IDs)
+func buildCacheEnv(builder bobfile.BuilderSpec, osArches bobfile.OsArchesSpec, fastbuild bool, debug bool) []string {
+	env := []string{}
+
+	for _, envKey := range builder.PassEnvs {
+		env = append(env, envKey+"="+os.Getenv(envKey))
+	}
+
+	for envKey, envValue := range builder.Envs {
+		env = append(env, envKey+"="+envValue)
+	}
+
+	for _, buildEnv := range osArches.AsBuildEnvVariables() {
+		env = append(env, buildEnv+"=true")
+	}
+
+	if fastbuild {
+		env = append(env, "FASTBUILD=true")
+	}
+
+	if debug {
+		env = append(env, "DEBUG=true")
+	}
+
+	sort.Strings(env)
+
+	return env
+}
+
+// cached results of a project's build passes. one dir per cache key.
+type buildCache struct {
+	dir string
+}
+
+func newBuildCache(projectName string) *buildCache {
+	// "/tmp/build" is used for stuff that is shared across builds
+	return &buildCache{dir: filepath.Join("/tmp/build/bob-cache", projectName)}
+}
+
+// returns nil if there is no cached result for the key
+func (b *buildCache) Lookup(key *typeddigest.Hash) (*buildCacheEntry, error) {
+	entry := &buildCacheEntry{}
+	if err := jsonfile.ReadDisallowUnknownFields(filepath.Join(b.entryDir(key), buildCacheEntryJSONName), entry); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("buildCache.Lookup: %w", err)
+	}
+
+	return entry, nil
+}
+
+// copies *outputs* (relative to *rootDir*) to the cache
+func (b *buildCache) Store(key *typeddigest.Hash, builderName string, rootDir string, outputs []Artefact) error {
+	withErr := func(err error) error { return fmt.Errorf("buildCache.Store: %w", err) }
+
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return withErr(err)
+	}
+
+	// stage to temp dir and rename as last step, so we never end up with a partially-written entry
+	stagingDir, err := os.MkdirTemp(b.dir, ".staging-")
+	if err != nil {
+		return withErr(err)
+	}
+	defer os.RemoveAll(stagingDir) // no-op after successful rename
+
+	for _, output := range outputs {
+		if err := copyFilePreservingMode(
+			filepath.Join(rootDir, filepath.FromSlash(output.Path)),
+			filepath.Join(stagingDir, buildCacheFilesDirName, filepath.FromSlash(output.Path)),
+		); err != nil {
+			return withErr(err)
+		}
+	}
+
+	if err := jsonfile.Write(filepath.Join(stagingDir, buildCacheEntryJSONName), buildCacheEntry{
+		Key:       key.String(),
+		Builder:   builderName,
+		CreatedAt: time.Now().UTC(),
+		Outputs:   outputs,
+	}); err != nil {
+		return withErr(err)
+	}
+
+	// a concurrent build could've stored the same key in the meantime
+	if err := os.RemoveAll(b.entryDir(key)); err != nil {
+		return withErr(err)
+	}
+
+	if err := os.Rename(stagingDir, b.entryDir(key)); err != nil {
+		return withErr(err)
+	}
+
+	return nil
+}
+
+// copies cached outputs back to *rootDir*
+func (b *buildCache) Restore(key *typeddigest.Hash, entry *buildCacheEntry, rootDir string) error {
+	withErr := func(err error) error { return fmt.Errorf("buildCache.Restore: %w", err) }
+
+	for _, output := range entry.Outputs {
+		destination := filepath.Join(rootDir, filepath.FromSlash(output.Path))
+
+		if err := copyFilePreservingMode(
+			filepath.Join(b.entryDir(key), buildCacheFilesDirName, filepath.FromSlash(output.Path)),
+			destination,
+		); err != nil {
+			return withErr(err)
+		}
+
+		// guard against corrupted cache
+		digest, err := digestFile(destination, typeddigest.Sha256)
+		if err != nil {
+			return withErr(err)
+		}
+
+		if digest.String() != output.Digest {
+			return withErr(fmt.Errorf("%s: digest mismatch: expected %s; got %s", output.Path, output.Digest, digest.String()))
+		}
+	}
+
+	return nil
+}
+
+func (b *buildCache) entryDir(key *typeddigest.Hash) string {
+	return filepath.Join(b.dir, key.HexDigest())
+}
+
+// returns cache key for the builder's build pass, or nil if the builder doesn't use caching
+func buildCacheKeyForBuilder(ctx context.Context, buildCtx *BuildContext, builder bobfile.BuilderSpec) (*typeddigest.Hash, error) {
+	withErr := func(err error) (*typeddigest.Hash, error) { return nil, fmt.Errorf("buildCacheKeyForBuilder: %w", err) }
+
+	if len(builder.CacheInputs) == 0 {
+		return nil, nil
+	}
+
+	inputs, err := buildCacheInputs(buildCtx.WorkspaceDir, builder.CacheInputs)
+	if err != nil {
+		return withErr(err)
+	}
+
+	archesToBuildFor := *buildCtx.Bobfile.OsArches
+	if buildCtx.FastBuild { // same as in runBuilder()
+		archesToBuildFor = buildArchOnlyForCurrentlyRunningArch(archesToBuildFor)
+	}
+
+	imageRef := builderImageName(buildCtx.Bobfile.ProjectName, builder)
+
+	// same as in runBuilder()
+	concurrent := buildCtx.Bobfile.Experiments.ParallelBuilders
+	pullProgress := io.Writer(os.Stdout)
+	if concurrent {
+		pullProgress = newLineSplitterTee(io.Discard, newBuilderOutput(builder.Name+"/build", concurrent).Line)
+	}
+
+	// need the image locally to know its ID. runBuilder() would pull it anyway.
+	if err := dockerPullIfRequired(ctx, imageRef, pullProgress); err != nil {
+		return withErr(err)
+	}
+
+	imageID, err := dockerImageID(ctx, imageRef)
+	if err != nil {
+		return withErr(err)
+	}
+
+	return buildCacheKey(buildCacheKeyMaterial{
+		Builder: builder.Name,
+		ImageID: imageID,
+		Command: builder.Commands.Build,
+		Env:     buildCacheEnv(builder, archesToBuildFor, buildCtx.FastBuild, buildCtx.Debug),
+		Inputs:  inputs,
+	})
+}
+
+func copyFilePreservingMode(source string, destination string) error {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return err
+	}
+
+	// remove first so we don't write through a possible hardlink / to a read-only file
+	if err := os.Remove(destination); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	destinationFile, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(destinationFile, sourceFile); err != nil {
+		destinationFile.Close()
+		return err
+	}
+
+	return destinationFile.Close()
+}
+
+// "1a2b3c4d..." (cache keys are long, humans only need to tell them apart)
+func buildCacheKeyShort(key *typeddigest.Hash) string {
+	hexDigest := key.HexDigest()
+	return hexDigest[:min(len(hexDigest), 12)]
+}
+
+// runs *buildPass*, unless the builder has a cached result in which case the result is restored
+// instead. returns true if the result came from the cache.
+func buildPassWithCache(ctx context.Context, buildCtx *BuildContext, builder bobfile.BuilderSpec, cache *buildCache, buildPass func() error) (bool, error) {
+	key, err := buildCacheKeyForBuilder(ctx, buildCtx, builder)
+	if err != nil {
+		return false, err
+	}
+
+	if key == nil { // builder doesn't use caching
+		return false, buildPass()
+	}
+
+	// published artefacts must carry the revision being published
+	if !buildCtx.PublishArtefacts {
+		entry, err := cache.Lookup(key)
+		if err != nil {
+			return false, err
+		}
+
+		if entry != nil {
+			newBuilderOutput(builder.Name+"/build", buildCtx.Bobfile.Experiments.ParallelBuilders).Line(fmt.Sprintf(
+				"using cached result %s from %s", buildCacheKeyShort(key), entry.CreatedAt.Format(time.RFC3339)))
+
+			return true, cache.Restore(key, entry, buildCtx.WorkspaceDir)
+		}
+	}
+
+	if err := buildPass(); err != nil {
+		return false, err // failed results are not cached
+	}
+
+	outputs, err := collectArtefacts(buildCtx.WorkspaceDir, []bobfile.BuilderSpec{builder})
+	if err != nil {
+		return false, err
+	}
+
+	return false, cache.Store(key, builder.Name, buildCtx.WorkspaceDir, outputs)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/typeddigest"
+)
+
+func TestBuildCacheInputs(t *testing.T) {
+	rootDir := t.TempDir()
+
+	writeFile := func(path string, content string) {
+		assert.Ok(t, os.MkdirAll(filepath.Dir(filepath.Join(rootDir, path)), 0755))
+		assert.Ok(t, os.WriteFile(filepath.Join(rootDir, path), []byte(content), 0644))
+	}
+
+	writeFile("go.mod", "module foo")
+	writeFile("cmd/foo/main.go", "package main")
+	writeFile("cmd/foo/sub/util.go", "package sub")
+
+	inputs, err := buildCacheInputs(rootDir, []string{"cmd", "go.*", "cmd/foo/main.go"}) // overlapping patterns
+	assert.Ok(t, err)
+	assert.Equal(t, strings.Join(inputs, "\n"), `512843855fcc92a51c810b1b58e0731c01eac9a6a23c157bfa02aad71edffbe7  cmd/foo/main.go
+fe46cc18f69efb734f6b2e83c990b5eb746cc408775c1fa279b0c4adb50b5afa  cmd/foo/sub/util.go
+003b575de2d83642bb557d5c4347efe7e2af1257b963e4465af3af8cd9c4c775  go.mod`)
+
+	_, err = buildCacheInputs(rootDir, []string{"go.sum"})
+	assert.Equal(t, err.Error(), "buildCacheInputs: cache_inputs pattern matched no files: go.sum")
+}
+
+func TestBuildCacheKey(t *testing.T) {
+	material := buildCacheKeyMaterial{
+		Builder: "default",
+		ImageID: "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592",
+		Command: []string{"build-go-project.sh"},
+		Env:     []string{"BUILD_LINUX_AMD64=true"},
+		Inputs:  []string{"a4b1ad9ff4c3c60f08cf9e8e26ab8d1ca0b2e4d2fe51ea7f6af7a2e3b07f9a53  go.mod"},
+	}
+
+	key := func() string {
+		hash, err := buildCacheKey(material)
+		assert.Ok(t, err)
+		return hash.String()
+	}
+
+	original := key()
+	assert.Equal(t, key(), original) // deterministic
+
+	material.Env = []string{"BUILD_LINUX_AMD64=true", "FASTBUILD=true"}
+	assert.Assert(t, key() != original)
+}
+
+func TestBuildCacheStoreAndRestore(t *testing.T) {
+	rootDir := t.TempDir()
+	cache := &buildCache{dir: t.TempDir()}
+
+	key, err := typeddigest.Sha256(strings.NewReader("dummy key"))
+	assert.Ok(t, err)
+
+	entry, err := cache.Lookup(key)
+	assert.Ok(t, err)
+	assert.Assert(t, entry == nil)
+
+	assert.Ok(t, os.MkdirAll(filepath.Join(rootDir, "rel"), 0755))
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel/bob"), []byte("binary"), 0755))
+
+	outputs, err := collectArtefacts(rootDir, []bobfile.BuilderSpec{{Name: "default", Artefacts: []string{"rel/*"}}})
+	assert.Ok(t, err)
+
+	assert.Ok(t, cache.Store(key, "default", rootDir, outputs))
+
+	// simulate a clean workspace
+	assert.Ok(t, os.RemoveAll(filepath.Join(rootDir, "rel")))
+
+	entry, err = cache.Lookup(key)
+	assert.Ok(t, err)
+	assert.Equal(t, entry.Builder, "default")
+
+	assert.Ok(t, cache.Restore(key, entry, rootDir))
+
+	content, err := os.ReadFile(filepath.Join(rootDir, "rel/bob"))
+	assert.Ok(t, err)
+	assert.Equal(t, string(content), "binary")
+
+	info, err := os.Stat(filepath.Join(rootDir, "rel/bob"))
+	assert.Ok(t, err)
+	assert.Equal(t, info.Mode().Perm().String(), "-rwxr-xr-x")
+}
@@ -0,0 +1,185 @@
+package main
+
+// Machine-readable build report, for consumption by e.g. release dashboards or chat bots.
+//
+//     $ bob build --report=build-report.json
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/function61/gokit/encoding/jsonfile"
+)
+
+type BuildReport struct {
+	ProjectName   string               `json:"project_name"`
+	Revision      BuildReportRevision  `json:"revision"`
+	Success       bool                 `json:"success"`
+	Error         string               `json:"error,omitempty"`
+	Published     bool                 `json:"published"` // whether artefacts were published
+	Builders      []BuildReportBuilder `json:"builders"`
+	Images        []BuildReportImage   `json:"images"`
+	Artefacts     []Artefact           `json:"artefacts"`
+	GitHubRelease string               `json:"github_release,omitempty"` // URL of the release artefacts were published to
+	Checks        []BuildReportCheck   `json:"checks"`
+	GeneratedAt   time.Time            `json:"generated_at"`
+}
+
+type BuildReportRevision struct {
+	VcKind             string `json:"vc_kind"`
+	RevisionID         string `json:"revision_id"`
+	RevisionIDShort    string `json:"revision_id_short"`
+	FriendlyRevisionID string `json:"friendly_revision_id"`
+}
+
+type BuildReportBuilder struct {
+	Name        string            `json:"name"`
+	ImageDigest string            `json:"image_digest,omitempty"` // digest of the builder's image that was used
+	Passes      []BuildReportPass `json:"passes"`
+}
+
+type BuildReportPass struct {
+	Pass       string `json:"pass"` // "prepare" | "build" | "publish"
+	DurationMs int64  `json:"duration_ms"`
+	ExitCode   int    `json:"exit_code"`
+	Cached     bool   `json:"cached,omitempty"` // result was restored from build cache
+	Error      string `json:"error,omitempty"`
+}
+
+type BuildReportImage struct {
+	Image        string   `json:"image"` // primary tag, like "fn61/turbobob:20200219_1609_9c39d027"
+	Tags         []string `json:"tags"`
+	Digest       string   `json:"digest,omitempty"`
+	Platforms    []string `json:"platforms,omitempty"`
+	Pushed       bool     `json:"pushed"`
+	Attestations []string `json:"attestations,omitempty"` // "sbom" | "provenance"
+	Signature    string   `json:"signature,omitempty"`    // ref of cosign signature
+}
+
+type BuildReportCheck struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// *output* and *buildErr* are results from build()
+func writeBuildReport(path string, buildCtx *BuildContext, output *buildOutput, buildErr error) error {
+	withErr := func(err error) error { return fmt.Errorf("writeBuildReport: %w", err) }
+
+	report, err := newBuildReport(buildCtx, output, buildErr)
+	if err != nil {
+		return withErr(err)
+	}
+
+	if err := jsonfile.Write(path, report); err != nil {
+		return withErr(err)
+	}
+
+	return nil
+}
+
+func newBuildReport(buildCtx *BuildContext, output *buildOutput, buildErr error) (*BuildReport, error) {
+	report := &BuildReport{
+		ProjectName: buildCtx.Bobfile.ProjectName,
+		Revision: BuildReportRevision{
+			VcKind:             buildCtx.RevisionID.VcKind,
+			RevisionID:         buildCtx.RevisionID.RevisionID,
+			RevisionIDShort:    buildCtx.RevisionID.RevisionIDShort,
+			FriendlyRevisionID: buildCtx.RevisionID.FriendlyRevisionID,
+		},
+		Success:     buildErr == nil,
+		Published:   buildCtx.PublishArtefacts && buildErr == nil,
+		Builders:    []BuildReportBuilder{},
+		Images:      []BuildReportImage{},
+		Artefacts:   []Artefact{},
+		Checks:      []BuildReportCheck{},
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	if buildErr != nil {
+		report.Error = buildErr.Error()
+	}
+
+	if output != nil {
+		report.Builders = buildReportBuilders(output)
+		report.Artefacts = output.artefacts
+		report.GitHubRelease = output.githubReleaseURL
+
+		for _, image := range output.images {
+			report.Images = append(report.Images, BuildReportImage{
+				Image:        image.tag,
+				Tags:         image.tags,
+				Digest:       image.digest,
+				Platforms:    image.platforms,
+				Pushed:       image.pushed,
+				Attestations: image.attestations,
+				Signature:    image.signature,
+			})
+		}
+	}
+
+	checksResults, err := RunChecks(buildCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, check := range checksResults {
+		report.Checks = append(report.Checks, BuildReportCheck{
+			Name:   check.Name,
+			Ok:     check.Ok,
+			Reason: check.Reason,
+		})
+	}
+
+	return report, nil
+}
+
+// groups passes by builder. builders are in the order they first ran.
+func buildReportBuilders(output *buildOutput) []BuildReportBuilder {
+	builders := []BuildReportBuilder{}
+	builderIdx := map[string]int{}
+
+	for _, pass := range output.passes {
+		idx, seen := builderIdx[pass.builder]
+		if !seen {
+			idx = len(builders)
+			builderIdx[pass.builder] = idx
+			builders = append(builders, BuildReportBuilder{
+				Name:        pass.builder,
+				ImageDigest: output.builderImages[pass.builder],
+				Passes:      []BuildReportPass{},
+			})
+		}
+
+		reportPass := BuildReportPass{
+			Pass:       pass.pass,
+			DurationMs: pass.duration.Milliseconds(),
+			ExitCode:   pass.exitCode,
+			Cached:     pass.cached,
+		}
+
+		if pass.err != nil {
+			reportPass.Error = pass.err.Error()
+		}
+
+		builders[idx].Passes = append(builders[idx].Passes, reportPass)
+	}
+
+	return builders
+}
+
+// 0 for success, process's exit code if it ran and failed, otherwise -1
+func exitCodeFromErr(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	// *containerExitError (or *exec.ExitError for processes)
+	var exitErr interface{ ExitCode() int }
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
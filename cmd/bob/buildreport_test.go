@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestBuildReportBuilders(t *testing.T) {
+	output := &buildOutput{
+		passes: []builderPassOutput{
+			{builder: "backend", pass: "build", duration: 1500 * time.Millisecond},
+			{builder: "frontend", pass: "build", duration: 2 * time.Second},
+			{builder: "backend", pass: "publish", duration: 300 * time.Millisecond, exitCode: 2, err: errors.New("exit status 2")},
+		},
+		builderImages: map[string]string{
+			"backend": "fn61/buildkit-golang@sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592",
+		},
+	}
+
+	assert.EqualJSON(t, buildReportBuilders(output), `[
+  {
+    "name": "backend",
+    "image_digest": "fn61/buildkit-golang@sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592",
+    "passes": [
+      {
+        "pass": "build",
+        "duration_ms": 1500,
+        "exit_code": 0
+      },
+      {
+        "pass": "publish",
+        "duration_ms": 300,
+        "exit_code": 2,
+        "error": "exit status 2"
+      }
+    ]
+  },
+  {
+    "name": "frontend",
+    "passes": [
+      {
+        "pass": "build",
+        "duration_ms": 2000,
+        "exit_code": 0
+      }
+    ]
+  }
+]`)
+}
+
+func TestExitCodeFromErr(t *testing.T) {
+	assert.Equal(t, exitCodeFromErr(nil), 0)
+	assert.Equal(t, exitCodeFromErr(errors.New("docker not found")), -1)
+}
@@ -0,0 +1,173 @@
+package main
+
+// Runs one pass (prepare / build / publish) over builders, honoring dependencies between them.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/function61/turbobob/pkg/bobfile"
+)
+
+// computes for each builder the builders that it must wait for. give it all the builders (not only
+// the ones in a pass), so dependencies can be resolved through builders not participating in a pass.
+func builderDependencies(builders []bobfile.BuilderSpec) map[string][]string {
+	dependencies := map[string][]string{}
+
+	for _, builder := range builders {
+		dependencies[builder.Name] = builder.DependsOn
+	}
+
+	return dependencies
+}
+
+// the traditional one-at-a-time order (no experiment opted-in). stops at first error.
+func runBuildersSequentially(
+	ctx context.Context,
+	builders []bobfile.BuilderSpec,
+	work func(context.Context, bobfile.BuilderSpec) error,
+) error {
+	for _, builder := range builders {
+		if err := work(ctx, builder); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type builderResult struct {
+	name string
+	err  error
+}
+
+// runs work for each builder as soon as all of its dependencies have completed. builders whose dependencies
+// are satisfied run concurrently. dependencies that are not part of *builders* (= not participating in
+// this pass) are skipped over: with A -> B -> C where B doesn't participate, C waits for A.
+//
+// fail-fast: on first error the context given to still-running work is canceled, no new work is started
+// and the first error is returned after running work has exited.
+func runBuildersInDependencyOrder(
+	ctx context.Context,
+	builders []bobfile.BuilderSpec,
+	dependencies map[string][]string,
+	work func(context.Context, bobfile.BuilderSpec) error,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	participating := map[string]bool{}
+	for _, builder := range builders {
+		participating[builder.Name] = true
+	}
+
+	started := map[string]bool{}
+	completed := map[string]bool{}
+
+	// dependencies within this pass, resolved through the non-participating ones
+	var participatingDependencies func(name string, visited map[string]bool) []string
+	participatingDependencies = func(name string, visited map[string]bool) []string {
+		resolved := []string{}
+		for _, dependency := range dependencies[name] {
+			if visited[dependency] {
+				continue
+			}
+			visited[dependency] = true
+
+			if participating[dependency] {
+				resolved = append(resolved, dependency)
+			} else {
+				resolved = append(resolved, participatingDependencies(dependency, visited)...)
+			}
+		}
+
+		return resolved
+	}
+
+	waitsFor := map[string][]string{}
+	for _, builder := range builders {
+		waitsFor[builder.Name] = participatingDependencies(builder.Name, map[string]bool{})
+	}
+
+	dependenciesCompleted := func(builder bobfile.BuilderSpec) bool {
+		for _, dependency := range waitsFor[builder.Name] {
+			if !completed[dependency] {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	results := make(chan builderResult, len(builders))
+	running := 0
+
+	var firstErr error
+
+	for {
+		if firstErr == nil {
+			for _, builder := range builders {
+				if started[builder.Name] || !dependenciesCompleted(builder) {
+					continue
+				}
+
+				started[builder.Name] = true
+				running++
+
+				go func(builder bobfile.BuilderSpec) {
+					results <- builderResult{builder.Name, work(ctx, builder)}
+				}(builder)
+			}
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+
+		if result.err != nil && firstErr == nil {
+			firstErr = result.err
+			cancel() // stop the other builders
+		}
+
+		completed[result.name] = true
+	}
+
+	if firstErr != nil {
+		return firstErr
+	}
+
+	if len(completed) != len(builders) { // should not happen, as cycles are validated when reading Bobfile
+		return errors.New("runBuildersInDependencyOrder: dependency cycle")
+	}
+
+	return nil
+}
+
+// when builders run concurrently their output would get mixed up, so we serialize output one
+// full line at a time and prefix each line with the builder to tell which line came from which builder.
+type builderOutput struct {
+	prefix string // empty if builders don't run concurrently
+}
+
+var builderOutputMu sync.Mutex
+
+func newBuilderOutput(builderNameOpDesc string, concurrent bool) *builderOutput {
+	if !concurrent {
+		return &builderOutput{}
+	}
+
+	return &builderOutput{prefix: fmt.Sprintf("[%s] ", builderNameOpDesc)}
+}
+
+func (b *builderOutput) Line(line string) {
+	builderOutputMu.Lock()
+	defer builderOutputMu.Unlock()
+
+	_, _ = os.Stdout.Write([]byte(b.prefix + line + "\n")) // need to add newline back
+}
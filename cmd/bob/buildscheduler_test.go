@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+)
+
+func TestRunBuildersInDependencyOrder(t *testing.T) {
+	builders := []bobfile.BuilderSpec{
+		{Name: "backend", DependsOn: []string{"documentation"}},
+		{Name: "frontend"},
+		{Name: "documentation"},
+	}
+
+	for _, tc := range []struct {
+		name     string
+		parallel bool
+		expected string
+	}{
+		{"sequential", false, "backend,frontend,documentation"},
+		{"parallel", true, "documentation,backend"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			order := []string{}
+			var mu sync.Mutex
+
+			work := func(_ context.Context, builder bobfile.BuilderSpec) error {
+				mu.Lock()
+				defer mu.Unlock()
+
+				// frontend has no dependencies so in parallel mode its position is non-deterministic
+				if !tc.parallel || builder.Name != "frontend" {
+					order = append(order, builder.Name)
+				}
+				return nil
+			}
+
+			if tc.parallel {
+				assert.Ok(t, runBuildersInDependencyOrder(context.Background(), builders, builderDependencies(builders), work))
+			} else {
+				assert.Ok(t, runBuildersSequentially(context.Background(), builders, work))
+			}
+
+			assert.Equal(t, strings.Join(order, ","), tc.expected)
+		})
+	}
+}
+
+// middle builder has no command for the pass (or change detection dropped it)
+func TestRunBuildersMiddleBuilderNotInPass(t *testing.T) {
+	allBuilders := []bobfile.BuilderSpec{
+		{Name: "first"},
+		{Name: "middle", DependsOn: []string{"first"}},
+		{Name: "last", DependsOn: []string{"middle"}},
+	}
+	buildersInPass := []bobfile.BuilderSpec{allBuilders[0], allBuilders[2]}
+
+	for _, tc := range []struct {
+		name     string
+		parallel bool
+	}{
+		{"sequential", false},
+		{"parallel", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			order := []string{}
+			running := 0
+			overlapped := false
+			var mu sync.Mutex
+
+			work := func(_ context.Context, builder bobfile.BuilderSpec) error {
+				mu.Lock()
+				running++
+				overlapped = overlapped || running > 1
+				mu.Unlock()
+
+				time.Sleep(50 * time.Millisecond) // so "last" would overlap if it didn't wait
+
+				mu.Lock()
+				defer mu.Unlock()
+				running--
+				order = append(order, builder.Name)
+				return nil
+			}
+
+			if tc.parallel { // "last" waits for "first" through "middle"
+				assert.Ok(t, runBuildersInDependencyOrder(context.Background(), buildersInPass, builderDependencies(allBuilders), work))
+			} else {
+				assert.Ok(t, runBuildersSequentially(context.Background(), buildersInPass, work))
+			}
+
+			assert.Equal(t, overlapped, false)
+			assert.Equal(t, strings.Join(order, ","), "first,last")
+		})
+	}
+}
+
+func TestRunBuildersInDependencyOrderNonParticipatingDependency(t *testing.T) {
+	builders := []bobfile.BuilderSpec{
+		{Name: "backend", DependsOn: []string{"documentation"}},
+	}
+
+	ran := false
+
+	assert.Ok(t, runBuildersInDependencyOrder(context.Background(), builders, builderDependencies(builders), func(_ context.Context, _ bobfile.BuilderSpec) error {
+		ran = true
+		return nil
+	}))
+
+	assert.Equal(t, ran, true)
+}
+
+func TestRunBuildersInDependencyOrderFailFast(t *testing.T) {
+	builders := []bobfile.BuilderSpec{
+		{Name: "slow"},
+		{Name: "failing"},
+		{Name: "dependsOnFailing", DependsOn: []string{"failing"}},
+	}
+
+	failingDone := make(chan struct{})
+
+	err := runBuildersInDependencyOrder(context.Background(), builders, builderDependencies(builders), func(ctx context.Context, builder bobfile.BuilderSpec) error {
+		switch builder.Name {
+		case "slow":
+			<-failingDone
+			<-ctx.Done() // gets canceled due to failing builder
+			return ctx.Err()
+		case "failing":
+			defer close(failingDone)
+			return errors.New("build failed")
+		default:
+			t.Fatalf("should not be started: %s", builder.Name)
+			return nil
+		}
+	})
+
+	assert.Equal(t, err.Error(), "build failed")
+}
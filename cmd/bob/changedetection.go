@@ -0,0 +1,201 @@
+package main
+
+// Monorepo support: "$ bob build --changed-since=<revision>" builds only builders affected by
+// files changed since the revision.
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/samber/lo"
+)
+
+// restricts the build to builders affected by changes since *revision*. *onlyCommitted* = false
+// also considers changes in the working directory.
+func restrictToBuildersChangedSince(buildCtx *BuildContext, revision string, onlyCommitted bool) error {
+	to := "" // working directory
+	if onlyCommitted {
+		to = buildCtx.RevisionID.RevisionID
+	}
+
+	changedFiles, err := buildCtx.VersionControl.ChangedFiles(revision, to)
+	if err != nil {
+		return fmt.Errorf("restrictToBuildersChangedSince: %w", err)
+	}
+
+	buildCtx.AffectedBuilders = affectedBuilders(buildCtx.Bobfile.Builders, changedFiles)
+	buildCtx.AffectedImages = affectedDockerImages(buildCtx.Bobfile.DockerImages, buildCtx.Bobfile.Builders, changedFiles, buildCtx.AffectedBuilders)
+
+	affectedNames := []string{}
+	for _, builder := range buildCtx.Bobfile.Builders {
+		if buildCtx.AffectedBuilders[builder.Name] {
+			affectedNames = append(affectedNames, builder.Name)
+		}
+	}
+
+	affectedImages := []string{}
+	for _, dockerImage := range buildCtx.Bobfile.DockerImages {
+		if buildCtx.AffectedImages[dockerImage.Image] {
+			affectedImages = append(affectedImages, dockerImage.Image)
+		}
+	}
+
+	printHeading(fmt.Sprintf(
+		"%d file(s) changed since %s, affected builders: %s, docker images: %s",
+		len(changedFiles),
+		revision,
+		firstNonEmpty(strings.Join(affectedNames, ", "), "(none)"),
+		firstNonEmpty(strings.Join(affectedImages, ", "), "(none)")))
+
+	return nil
+}
+
+// returns names of builders affected by *changedFiles* (relative to project root, slash-separated),
+// plus their dependencies (a fresh checkout doesn't have dependencies' outputs)
+func affectedBuilders(builders []bobfile.BuilderSpec, changedFiles []string) map[string]bool {
+	affected := map[string]bool{}
+
+	for _, builder := range builders {
+		if changesAffectBuilder(builder, changedFiles) {
+			affected[builder.Name] = true
+		}
+	}
+
+	// builders that depend on an affected builder are affected too (they can consume its outputs)
+	for changed := true; changed; {
+		changed = false
+
+		for _, builder := range builders {
+			if affected[builder.Name] {
+				continue
+			}
+
+			for _, dependency := range builder.DependsOn {
+				if affected[dependency] {
+					affected[builder.Name] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	builderByName := map[string]bobfile.BuilderSpec{}
+	for _, builder := range builders {
+		builderByName[builder.Name] = builder
+	}
+
+	var addDependencies func(builder bobfile.BuilderSpec)
+	addDependencies = func(builder bobfile.BuilderSpec) {
+		for _, dependency := range builder.DependsOn {
+			if !affected[dependency] {
+				affected[dependency] = true
+				addDependencies(builderByName[dependency])
+			}
+		}
+	}
+
+	for _, builder := range builders {
+		if affected[builder.Name] {
+			addDependencies(builder)
+		}
+	}
+
+	return affected
+}
+
+// returns refs of Docker images affected by *changedFiles*. an image is affected by changes in its
+// build context, and by affected builders whose outputs are in its build context (builders' outputs
+// are commonly copied into images).
+func affectedDockerImages(
+	dockerImages []bobfile.DockerImageSpec,
+	builders []bobfile.BuilderSpec,
+	changedFiles []string,
+	affectedBuilders map[string]bool,
+) map[string]bool {
+	affected := map[string]bool{}
+
+	for _, dockerImage := range dockerImages {
+		contextDir := path.Dir(dockerImage.DockerfilePath) // same as in buildAndPushOneDockerImage()
+
+		outputsInContext := lo.ContainsBy(builders, func(builder bobfile.BuilderSpec) bool {
+			return affectedBuilders[builder.Name] && lo.ContainsBy(builderOutputPaths(builder), func(outputPath string) bool {
+				return pathContains(contextDir, outputPath) || pathContains(outputPath, contextDir)
+			})
+		})
+
+		affected[dockerImage.Image] = outputsInContext || lo.ContainsBy(changedFiles, func(changedFile string) bool {
+			return changedFile == bobfile.Name || pathContains(contextDir, changedFile)
+		})
+	}
+
+	return affected
+}
+
+// paths relative to project root where builder writes its outputs: directories of its artefacts,
+// or its mount source if it doesn't declare artefacts. "." means the whole project.
+func builderOutputPaths(builder bobfile.BuilderSpec) []string {
+	if len(builder.Artefacts) == 0 {
+		return []string{firstNonEmpty(builder.MountSource, ".")} // empty mount source means project root
+	}
+
+	// "rel/*" => "rel"
+	return lo.Map(builder.Artefacts, func(artefactGlob string, _ int) string {
+		staticSegments := []string{}
+		for _, segment := range strings.Split(path.Dir(artefactGlob), "/") {
+			if strings.ContainsAny(segment, `*?[\`) {
+				break
+			}
+
+			staticSegments = append(staticSegments, segment)
+		}
+
+		return firstNonEmpty(strings.Join(staticSegments, "/"), ".")
+	})
+}
+
+func changesAffectBuilder(builder bobfile.BuilderSpec, changedFiles []string) bool {
+	watchPaths := builderWatchPaths(builder)
+
+	for _, changedFile := range changedFiles {
+		if changedFile == bobfile.Name { // can change anything about any builder
+			return true
+		}
+
+		for _, watchPath := range watchPaths {
+			if pathContains(watchPath, changedFile) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// paths relative to project root. "." means the whole project.
+func builderWatchPaths(builder bobfile.BuilderSpec) []string {
+	watchPaths := builder.WatchPaths
+	if len(watchPaths) == 0 {
+		watchPaths = []string{firstNonEmpty(builder.MountSource, ".")} // empty mount source means project root
+	}
+
+	// builder's own image definition is an input too
+	if builderType, dockerfilePath, err := parseBuilderUsesType(builder.Uses); err == nil && builderType == builderUsesTypeDockerfile {
+		watchPaths = append(watchPaths, dockerfilePath)
+	}
+
+	return watchPaths
+}
+
+// pathContains("frontend", "frontend/src/app.ts") => true
+// pathContains("frontend", "frontend-legacy/app.ts") => false
+func pathContains(parent string, child string) bool {
+	parent = path.Clean(parent)
+	if parent == "." {
+		return true
+	}
+
+	return child == parent || strings.HasPrefix(child, parent+"/")
+}
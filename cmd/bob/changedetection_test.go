@@ -0,0 +1,83 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+)
+
+func TestAffectedBuilders(t *testing.T) {
+	builders := []bobfile.BuilderSpec{
+		{Name: "backend", MountSource: "backend/", DependsOn: []string{"documentation"}},
+		{Name: "frontend", Uses: "dockerfile://build-frontend.Dockerfile", MountSource: "frontend"},
+		{Name: "documentation", WatchPaths: []string{"docs", "README.md"}},
+		{Name: "everything"}, // no mount source => whole project
+		{Name: "api-docs", MountSource: "api-docs", DependsOn: []string{"backend"}},
+	}
+
+	for _, tc := range []struct {
+		changedFiles []string
+		expected     string
+	}{
+		{[]string{"backend/main.go"}, "api-docs,backend,documentation,everything"},   // dependent and dependency of backend
+		{[]string{"api-docs/index.md"}, "api-docs,backend,documentation,everything"}, // dependencies transitively
+		{[]string{"frontend-legacy/app.ts"}, "everything"},
+		{[]string{"build-frontend.Dockerfile"}, "everything,frontend"},
+		{[]string{"docs/index.md"}, "api-docs,backend,documentation,everything"}, // backend depends on documentation
+		{[]string{".config/turbobob.json"}, "api-docs,backend,documentation,everything,frontend"},
+		{[]string{}, ""},
+	} {
+		t.Run(strings.Join(tc.changedFiles, ","), func(t *testing.T) {
+			affected := []string{}
+			for name := range affectedBuilders(builders, tc.changedFiles) {
+				affected = append(affected, name)
+			}
+			sort.Strings(affected)
+
+			assert.Equal(t, strings.Join(affected, ","), tc.expected)
+		})
+	}
+}
+
+func TestAffectedDockerImages(t *testing.T) {
+	dockerImages := []bobfile.DockerImageSpec{
+		{Image: "myorg/backend", DockerfilePath: "backend/Dockerfile"},
+		{Image: "myorg/frontend", DockerfilePath: "frontend/Dockerfile"},
+		{Image: "myorg/everything", DockerfilePath: "Dockerfile"},
+	}
+
+	builders := []bobfile.BuilderSpec{
+		{Name: "backend", MountSource: "backend"},
+		{Name: "frontend", Artefacts: []string{"frontend/dist/*.js"}},
+		{Name: "documentation", MountSource: "docs"},
+		{Name: "everything"}, // no mount source => whole project
+	}
+
+	affected := func(changedFiles []string, affectedBuilders map[string]bool) string {
+		images := []string{}
+		for image, isAffected := range affectedDockerImages(dockerImages, builders, changedFiles, affectedBuilders) {
+			if isAffected {
+				images = append(images, image)
+			}
+		}
+		sort.Strings(images)
+
+		return strings.Join(images, ",")
+	}
+
+	assert.Equal(t, affected([]string{"backend/Dockerfile"}, map[string]bool{}), "myorg/backend,myorg/everything")
+	assert.Equal(t, affected([]string{".config/turbobob.json"}, map[string]bool{}), "myorg/backend,myorg/everything,myorg/frontend")
+	// builders' outputs affect images whose build context they're in
+	assert.Equal(t, affected([]string{"README.md"}, map[string]bool{"backend": true}), "myorg/backend,myorg/everything")
+	assert.Equal(t, affected([]string{"README.md"}, map[string]bool{"frontend": true}), "myorg/everything,myorg/frontend")
+	assert.Equal(t, affected([]string{"README.md"}, map[string]bool{"everything": true}), "myorg/backend,myorg/everything,myorg/frontend")
+}
+
+func TestBuilderOutputPaths(t *testing.T) {
+	assert.Equal(t, strings.Join(builderOutputPaths(bobfile.BuilderSpec{Artefacts: []string{"rel/*", "frontend/dist/**/*.js", "*.tar.gz", "out/bin"}}), ","), "rel,frontend/dist,.,out")
+	assert.Equal(t, strings.Join(builderOutputPaths(bobfile.BuilderSpec{MountSource: "backend/"}), ","), "backend/")
+	assert.Equal(t, strings.Join(builderOutputPaths(bobfile.BuilderSpec{}), ","), ".")
+}
@@ -5,6 +5,7 @@ import (
 
 	. "github.com/function61/gokit/builtin"
 	"github.com/function61/gokit/os/osutil"
+	"github.com/samber/lo"
 )
 
 func RunChecks(buildCtx *BuildContext) ([]CheckResult, error) {
@@ -15,6 +16,8 @@ func RunChecks(buildCtx *BuildContext) ([]CheckResult, error) {
 
 	checks := []func(*CheckContext) error{
 		passableEnvVarsPresent,
+		registryCredentialsPresent,
+		subreposAtPinnedRevision,
 		licensePresent,
 		readmePresent,
 	}
@@ -86,6 +89,54 @@ func passableEnvVarsPresent(ctx *CheckContext) error {
 	return nil
 }
 
+// each image to publish can get its credentials. doesn't yet log in, so can't check validity.
+func registryCredentialsPresent(ctx *CheckContext) error {
+	for _, dockerImage := range ctx.BuildContext.Bobfile.DockerImages {
+		check := ctx.NewCheck(fmt.Sprintf("Registry credentials(%s)", dockerImage.Image))
+
+		creds, err := func() (*DockerCredentials, error) {
+			credentialsObtainer, err := getDockerCredentialsObtainer(dockerImage)
+			if err != nil {
+				return nil, err
+			}
+
+			return credentialsObtainer.Obtain()
+		}()
+		switch {
+		case err != nil:
+			check.Fail(err.Error())
+		case creds == nil:
+			check.Fail("Not found")
+		default:
+			check.OkWithReason("as " + creds.Username)
+		}
+	}
+
+	return nil
+}
+
+// changing a subrepo's pinned revision doesn't update existing checkouts
+func subreposAtPinnedRevision(ctx *CheckContext) error {
+	for _, subrepo := range ctx.BuildContext.Bobfile.Subrepos {
+		check := ctx.NewCheck(fmt.Sprintf("Subrepo(%s)", subrepo.Destination))
+
+		// one broken subrepo shouldn't prevent checking the rest
+		status, err := resolveSubrepoStatus(subrepo.Destination, subrepo)
+		switch {
+		case err != nil:
+			check.Fail(err.Error())
+		case !status.Cloned: // will be cloned at pinned revision
+			check.OkWithReason("Not cloned")
+		case status.Drifted():
+			check.Fail(fmt.Sprintf("At %s, pinned to %s (run `$ bob subrepos sync`)", lo.Substring(status.Current, 0, 8), status.Subrepo.Revision))
+		default:
+			check.Ok()
+		}
+	}
+
+	return nil
+}
+
 // plumbing below
 
 type CheckResult struct {
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/versioncontrol"
+)
+
+func TestRegistryCredentialsPresent(t *testing.T) {
+	t.Setenv("DOCKER_CREDS", "joonas:hunter2")
+	t.Setenv("DOCKER_CREDS_GHCR", "")
+
+	ctx := &CheckContext{
+		BuildContext: &BuildContext{Bobfile: &bobfile.Bobfile{DockerImages: []bobfile.DockerImageSpec{
+			{Image: "function61/turbobob"},
+			{Image: "ghcr.io/function61/turbobob", CredsEnv: "DOCKER_CREDS_GHCR"},
+		}}},
+	}
+
+	assert.Ok(t, registryCredentialsPresent(ctx))
+
+	assert.Equal(t, len(ctx.Results), 2)
+	assert.Equal(t, ctx.Results[0], CheckResult{Name: "Registry credentials(function61/turbobob)", Ok: true, Reason: "as joonas"})
+	assert.Equal(t, ctx.Results[1], CheckResult{Name: "Registry credentials(ghcr.io/function61/turbobob)", Ok: false, Reason: "Not found"})
+}
+
+func TestSubreposAtPinnedRevision(t *testing.T) {
+	ctx := &CheckContext{
+		BuildContext: &BuildContext{Bobfile: &bobfile.Bobfile{Subrepos: []bobfile.SubrepoSpec{
+			{Destination: ".", Kind: "svn"}, // exists, but status can't be resolved
+			{Destination: "vendor/not-cloned-yet", Kind: versioncontrol.KindGit},
+		}}},
+	}
+
+	assert.Ok(t, subreposAtPinnedRevision(ctx))
+
+	assert.Equal(t, len(ctx.Results), 2)
+	assert.Equal(t, ctx.Results[0], CheckResult{Name: "Subrepo(.)", Ok: false, Reason: "unsupported Kind: svn"})
+	assert.Equal(t, ctx.Results[1], CheckResult{Name: "Subrepo(vendor/not-cloned-yet)", Ok: true, Reason: "Not cloned"})
+}
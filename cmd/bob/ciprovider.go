@@ -0,0 +1,360 @@
+package main
+
+// Bob can autodetect build settings (are we building for a pull request, which repository etc.)
+// from the environment of the CI system it's running in. CI systems also differ in how they
+// present logs (collapsible groups, annotations) and build summaries.
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// build settings that we can derive from CI system's environment
+type ciBuildSettings struct {
+	PublishArtefacts bool   // false for pull request builds
+	RepositoryURL    string // human-visitable URL, like "https://github.com/function61/turbobob"
+	IsDefaultBranch  bool   // whether we are in "main" / "master" or equivalent branch
+	Debug            bool   // user asked the CI system for debug logging
+}
+
+type annotationLevel string
+
+const (
+	annotationLevelWarning annotationLevel = "warning"
+	annotationLevelError   annotationLevel = "error"
+)
+
+// stuff CI systems can tell us and do for us
+type CIProvider interface {
+	Name() string
+	// is Bob running inside this CI system?
+	Detected() bool
+	BuildSettings() (*ciBuildSettings, error)
+	// lines to print at start and end of a collapsible group of log lines. empty if CI system doesn't support groups.
+	LogLineGroup(group string) (string, func() string)
+	// a line that makes the message stand out in the CI system's UI
+	Annotation(level annotationLevel, message string) string
+	// no-op if CI system doesn't support build summaries
+	WriteBuildSummary(output *buildOutput) error
+	// ENV keys relayed as-is to build containers so they can detect the CI system too
+	EnvsToRelay() []string
+}
+
+// returns nil if we're not running inside a known CI system
+func resolveCIProvider(getenv func(string) string) CIProvider {
+	candidates := []CIProvider{
+		// Gitea and Forgejo also set GITHUB_ACTIONS=true, so they need to be detected before GitHub
+		&giteaActions{githubActions{getenv}},
+		&githubActions{getenv},
+		&gitLabCI{getenv: getenv},
+		&drone{getenv},
+		&jenkins{getenv},
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Detected() {
+			return candidate
+		}
+	}
+
+	return nil
+}
+
+// https://docs.github.com/en/actions/reference/variables-reference
+type githubActions struct {
+	getenv func(string) string
+}
+
+var _ CIProvider = (*githubActions)(nil)
+
+func (g *githubActions) Name() string {
+	return "GitHub Actions"
+}
+
+func (g *githubActions) Detected() bool {
+	return g.getenv("GITHUB_ACTIONS") == "true"
+}
+
+func (g *githubActions) BuildSettings() (*ciBuildSettings, error) {
+	publishArtefacts, err := func() (bool, error) {
+		event := g.getenv("GITHUB_EVENT_NAME")
+		switch event {
+		case "push":
+			return true, nil
+		case "pull_request": // PRs don't publish artefacts
+			return false, nil
+		default:
+			return false, fmt.Errorf("unsupported event: %s", event)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &ciBuildSettings{
+		PublishArtefacts: publishArtefacts,
+		Debug:            g.getenv("RUNNER_DEBUG") == "1",
+	}
+
+	if ownerAndRepo := g.getenv("GITHUB_REPOSITORY"); ownerAndRepo != "" {
+		// "function61/turbobob" => "https://github.com/function61/turbobob"
+		settings.RepositoryURL = fmt.Sprintf("%s/%s", g.getenv("GITHUB_SERVER_URL"), ownerAndRepo)
+	}
+
+	// not automatically available as ENV variable (it only exists as a workflow variable `github.event.repository.default_branch` which you'd have to pass to ENV)
+	defaultBranchName := firstNonEmpty(g.getenv("DEFAULT_BRANCH_NAME"), "main")
+	settings.IsDefaultBranch = defaultBranchName == g.getenv("GITHUB_REF_NAME")
+
+	return settings, nil
+}
+
+func (g *githubActions) LogLineGroup(group string) (string, func() string) {
+	return "::group::" + group, func() string { return "::endgroup::" }
+}
+
+// https://docs.github.com/en/actions/reference/workflow-commands-for-github-actions#setting-an-error-message
+func (g *githubActions) Annotation(level annotationLevel, message string) string {
+	// multi-line messages need to be escaped
+	return fmt.Sprintf("::%s::%s", level, strings.ReplaceAll(message, "\n", "%0A"))
+}
+
+// https://github.blog/news-insights/product-news/supercharging-github-actions-with-job-summaries/
+func (g *githubActions) WriteBuildSummary(output *buildOutput) error {
+	if stepSummaryFilename := g.getenv("GITHUB_STEP_SUMMARY"); stepSummaryFilename != "" && len(output.images) > 0 {
+		return githubStepSummaryWriteImages(stepSummaryFilename, output.images)
+	}
+
+	return nil
+}
+
+func (g *githubActions) EnvsToRelay() []string {
+	// "Always set to true when GitHub Actions is running the workflow. You can use this variable to
+	// differentiate when tests are being run locally or by GitHub Actions."
+	return []string{"GITHUB_ACTIONS"}
+}
+
+// Gitea Actions and its fork Forgejo Actions are (mostly) compatible with GitHub Actions' ENV
+// variables and workflow commands.
+//
+// https://docs.gitea.com/usage/actions/comparison
+type giteaActions struct {
+	githubActions
+}
+
+var _ CIProvider = (*giteaActions)(nil)
+
+func (g *giteaActions) Name() string {
+	if g.getenv("FORGEJO_ACTIONS") == "true" {
+		return "Forgejo Actions"
+	} else {
+		return "Gitea Actions"
+	}
+}
+
+func (g *giteaActions) Detected() bool {
+	return g.getenv("GITEA_ACTIONS") == "true" || g.getenv("FORGEJO_ACTIONS") == "true"
+}
+
+func (g *giteaActions) WriteBuildSummary(_ *buildOutput) error {
+	return nil // job summaries not supported
+}
+
+func (g *giteaActions) EnvsToRelay() []string {
+	return []string{"GITHUB_ACTIONS", "GITEA_ACTIONS", "FORGEJO_ACTIONS"}
+}
+
+// https://docs.gitlab.com/ee/ci/variables/predefined_variables.html
+type gitLabCI struct {
+	getenv          func(string) string
+	sectionsStarted int // for generating unique section names
+}
+
+var _ CIProvider = (*gitLabCI)(nil)
+
+func (g *gitLabCI) Name() string {
+	return "GitLab CI"
+}
+
+func (g *gitLabCI) Detected() bool {
+	return g.getenv("GITLAB_CI") == "true"
+}
+
+func (g *gitLabCI) BuildSettings() (*ciBuildSettings, error) {
+	publishArtefacts, err := func() (bool, error) {
+		source := g.getenv("CI_PIPELINE_SOURCE")
+		switch source {
+		case "push", "web", "api", "trigger":
+			return true, nil
+		case "schedule", "pipeline", "parent_pipeline":
+			// child pipeline of a MR pipeline still builds a MR (MR variables are passed down)
+			return g.getenv("CI_MERGE_REQUEST_IID") == "", nil
+		case "merge_request_event", "external_pull_request_event": // MRs don't publish artefacts
+			return false, nil
+		default:
+			return false, fmt.Errorf("unsupported pipeline source: %s", source)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// unlike in GitHub, the default branch name is available as ENV variable
+	defaultBranchName := g.getenv("CI_DEFAULT_BRANCH")
+
+	return &ciBuildSettings{
+		PublishArtefacts: publishArtefacts,
+		RepositoryURL:    g.getenv("CI_PROJECT_URL"), // "https://gitlab.com/myorg/myproject"
+		IsDefaultBranch:  defaultBranchName != "" && defaultBranchName == g.getenv("CI_COMMIT_REF_NAME"),
+		Debug:            g.getenv("CI_DEBUG_TRACE") == "true",
+	}, nil
+}
+
+// https://docs.gitlab.com/ee/ci/jobs/job_logs.html#custom-collapsible-sections
+func (g *gitLabCI) LogLineGroup(group string) (string, func() string) {
+	g.sectionsStarted++
+	sectionName := fmt.Sprintf("bob_section_%d", g.sectionsStarted)
+
+	start := fmt.Sprintf("\x1b[0Ksection_start:%d:%s[collapsed=true]\r\x1b[0K%s", time.Now().Unix(), sectionName, group)
+
+	return start, func() string {
+		return fmt.Sprintf("\x1b[0Ksection_end:%d:%s\r\x1b[0K", time.Now().Unix(), sectionName)
+	}
+}
+
+func (g *gitLabCI) Annotation(level annotationLevel, message string) string {
+	return plainAnnotation(level, message) // no annotation support
+}
+
+func (g *gitLabCI) WriteBuildSummary(_ *buildOutput) error {
+	return nil // no build summary support
+}
+
+func (g *gitLabCI) EnvsToRelay() []string {
+	return []string{"GITLAB_CI"}
+}
+
+// https://docs.drone.io/pipeline/environment/reference/
+type drone struct {
+	getenv func(string) string
+}
+
+var _ CIProvider = (*drone)(nil)
+
+func (d *drone) Name() string {
+	return "Drone"
+}
+
+func (d *drone) Detected() bool {
+	return d.getenv("DRONE") == "true"
+}
+
+func (d *drone) BuildSettings() (*ciBuildSettings, error) {
+	publishArtefacts, err := func() (bool, error) {
+		event := d.getenv("DRONE_BUILD_EVENT")
+		switch event {
+		case "push", "tag", "promote", "custom":
+			return true, nil
+		case "pull_request": // PRs don't publish artefacts
+			return false, nil
+		default:
+			return false, fmt.Errorf("unsupported event: %s", event)
+		}
+	}()
+	if err != nil {
+		return nil, err
+	}
+
+	// DRONE_REPO_BRANCH is the repository's default branch.
+	// for pull requests DRONE_COMMIT_BRANCH is the target branch, so we've to look at the source branch.
+	defaultBranchName := d.getenv("DRONE_REPO_BRANCH")
+
+	return &ciBuildSettings{
+		PublishArtefacts: publishArtefacts,
+		RepositoryURL:    d.getenv("DRONE_REPO_LINK"),
+		IsDefaultBranch:  defaultBranchName != "" && defaultBranchName == d.getenv("DRONE_SOURCE_BRANCH"),
+	}, nil
+}
+
+func (d *drone) LogLineGroup(_ string) (string, func() string) {
+	return "", nil // each step already is its own log
+}
+
+func (d *drone) Annotation(level annotationLevel, message string) string {
+	return plainAnnotation(level, message)
+}
+
+func (d *drone) WriteBuildSummary(_ *buildOutput) error {
+	return nil
+}
+
+func (d *drone) EnvsToRelay() []string {
+	return []string{"DRONE"}
+}
+
+// https://www.jenkins.io/doc/book/pipeline/jenkinsfile/#using-environment-variables
+type jenkins struct {
+	getenv func(string) string
+}
+
+var _ CIProvider = (*jenkins)(nil)
+
+func (j *jenkins) Name() string {
+	return "Jenkins"
+}
+
+func (j *jenkins) Detected() bool {
+	return j.getenv("JENKINS_URL") != ""
+}
+
+func (j *jenkins) BuildSettings() (*ciBuildSettings, error) {
+	// multibranch pipelines set BRANCH_NAME, Git plugin sets GIT_BRANCH like "origin/main"
+	branchName := firstNonEmpty(j.getenv("BRANCH_NAME"), strings.TrimPrefix(j.getenv("GIT_BRANCH"), "origin/"))
+
+	// no ENV variable for default branch available
+	defaultBranchName := firstNonEmpty(j.getenv("DEFAULT_BRANCH_NAME"), "main")
+
+	// Git plugin's URL can also be SSH-based, which is not human-visitable
+	repositoryURL := func() string {
+		gitURL := j.getenv("GIT_URL")
+		if strings.HasPrefix(gitURL, "https://") {
+			return strings.TrimSuffix(gitURL, ".git")
+		} else {
+			return ""
+		}
+	}()
+
+	return &ciBuildSettings{
+		PublishArtefacts: j.getenv("CHANGE_ID") == "", // multibranch pipelines set CHANGE_ID for PRs. PRs don't publish artefacts
+		RepositoryURL:    repositoryURL,
+		IsDefaultBranch:  branchName == defaultBranchName,
+	}, nil
+}
+
+func (j *jenkins) LogLineGroup(_ string) (string, func() string) {
+	return "", nil // no support without plugins
+}
+
+func (j *jenkins) Annotation(level annotationLevel, message string) string {
+	return plainAnnotation(level, message)
+}
+
+func (j *jenkins) WriteBuildSummary(_ *buildOutput) error {
+	return nil
+}
+
+func (j *jenkins) EnvsToRelay() []string {
+	return []string{"JENKINS_URL"}
+}
+
+// for CI systems that don't support annotations
+func plainAnnotation(level annotationLevel, message string) string {
+	return fmt.Sprintf("%s: %s", strings.ToUpper(string(level)), message)
+}
+
+// the CI system we're running in, or nil. resolved only once because some providers have state.
+var currentCIProvider = sync.OnceValue(func() CIProvider {
+	return resolveCIProvider(os.Getenv)
+})
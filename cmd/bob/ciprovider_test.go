@@ -0,0 +1,212 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestGitLabCIBuildSettings(t *testing.T) {
+	provider := resolveCIProvider(fakeEnv(map[string]string{
+		"GITLAB_CI":          "true",
+		"CI_PIPELINE_SOURCE": "push",
+		"CI_PROJECT_URL":     "https://gitlab.com/myorg/myproject",
+		"CI_DEFAULT_BRANCH":  "main",
+		"CI_COMMIT_REF_NAME": "main",
+	}))
+
+	assert.Equal(t, provider.Name(), "GitLab CI")
+
+	settings, err := provider.BuildSettings()
+	assert.Ok(t, err)
+	assert.EqualJSON(t, settings, `{
+  "PublishArtefacts": true,
+  "RepositoryURL": "https://gitlab.com/myorg/myproject",
+  "IsDefaultBranch": true,
+  "Debug": false
+}`)
+}
+
+func TestGitLabCIMergeRequestDoesNotPublish(t *testing.T) {
+	settings, err := resolveCIProvider(fakeEnv(map[string]string{
+		"GITLAB_CI":          "true",
+		"CI_PIPELINE_SOURCE": "merge_request_event",
+		"CI_DEFAULT_BRANCH":  "main",
+		"CI_COMMIT_REF_NAME": "feature-x",
+		"CI_DEBUG_TRACE":     "true",
+	})).BuildSettings()
+	assert.Ok(t, err)
+	assert.Equal(t, settings.PublishArtefacts, false)
+	assert.Equal(t, settings.IsDefaultBranch, false)
+	assert.Equal(t, settings.Debug, true)
+
+	_, err = resolveCIProvider(fakeEnv(map[string]string{
+		"GITLAB_CI":          "true",
+		"CI_PIPELINE_SOURCE": "chat",
+	})).BuildSettings()
+	assert.Equal(t, err.Error(), "unsupported pipeline source: chat")
+}
+
+func TestCIProviderBuildSettings(t *testing.T) {
+	for _, tc := range []struct {
+		name             string
+		env              map[string]string
+		expectedProvider string
+		expected         ciBuildSettings
+	}{
+		{
+			name: "GitHub push to default branch",
+			env: map[string]string{
+				"GITHUB_ACTIONS":    "true",
+				"GITHUB_EVENT_NAME": "push",
+				"GITHUB_SERVER_URL": "https://github.com",
+				"GITHUB_REPOSITORY": "function61/turbobob",
+				"GITHUB_REF_NAME":   "main",
+				"RUNNER_DEBUG":      "1",
+			},
+			expectedProvider: "GitHub Actions",
+			expected:         ciBuildSettings{true, "https://github.com/function61/turbobob", true, true},
+		},
+		{
+			name: "Gitea pull request",
+			env: map[string]string{
+				"GITHUB_ACTIONS":    "true",
+				"GITEA_ACTIONS":     "true",
+				"GITHUB_EVENT_NAME": "pull_request",
+				"GITHUB_SERVER_URL": "https://gitea.example.com",
+				"GITHUB_REPOSITORY": "myorg/myproject",
+				"GITHUB_REF_NAME":   "feature-x",
+			},
+			expectedProvider: "Gitea Actions",
+			expected:         ciBuildSettings{false, "https://gitea.example.com/myorg/myproject", false, false},
+		},
+		{
+			name: "Forgejo push",
+			env: map[string]string{
+				"GITHUB_ACTIONS":      "true",
+				"FORGEJO_ACTIONS":     "true",
+				"GITHUB_EVENT_NAME":   "push",
+				"GITHUB_REF_NAME":     "master",
+				"DEFAULT_BRANCH_NAME": "master",
+			},
+			expectedProvider: "Forgejo Actions",
+			expected:         ciBuildSettings{true, "", true, false},
+		},
+		{
+			name: "GitLab scheduled pipeline",
+			env: map[string]string{
+				"GITLAB_CI":          "true",
+				"CI_PIPELINE_SOURCE": "schedule",
+				"CI_DEFAULT_BRANCH":  "main",
+				"CI_COMMIT_REF_NAME": "main",
+			},
+			expectedProvider: "GitLab CI",
+			expected:         ciBuildSettings{true, "", true, false},
+		},
+		{
+			name: "GitLab multi-project pipeline",
+			env: map[string]string{
+				"GITLAB_CI":          "true",
+				"CI_PIPELINE_SOURCE": "pipeline",
+				"CI_DEFAULT_BRANCH":  "main",
+				"CI_COMMIT_REF_NAME": "release",
+			},
+			expectedProvider: "GitLab CI",
+			expected:         ciBuildSettings{true, "", false, false},
+		},
+		{
+			name: "GitLab child pipeline",
+			env: map[string]string{
+				"GITLAB_CI":          "true",
+				"CI_PIPELINE_SOURCE": "parent_pipeline",
+				"CI_DEFAULT_BRANCH":  "main",
+				"CI_COMMIT_REF_NAME": "main",
+			},
+			expectedProvider: "GitLab CI",
+			expected:         ciBuildSettings{true, "", true, false},
+		},
+		{
+			name: "GitLab child pipeline of merge request",
+			env: map[string]string{
+				"GITLAB_CI":            "true",
+				"CI_PIPELINE_SOURCE":   "parent_pipeline",
+				"CI_MERGE_REQUEST_IID": "42",
+				"CI_DEFAULT_BRANCH":    "main",
+				"CI_COMMIT_REF_NAME":   "feature-x",
+			},
+			expectedProvider: "GitLab CI",
+			expected:         ciBuildSettings{false, "", false, false},
+		},
+		{
+			name: "Drone push to default branch",
+			env: map[string]string{
+				"DRONE":               "true",
+				"DRONE_BUILD_EVENT":   "push",
+				"DRONE_REPO_LINK":     "https://github.com/myorg/myproject",
+				"DRONE_REPO_BRANCH":   "main",
+				"DRONE_SOURCE_BRANCH": "main",
+			},
+			expectedProvider: "Drone",
+			expected:         ciBuildSettings{true, "https://github.com/myorg/myproject", true, false},
+		},
+		{
+			name: "Jenkins multibranch pull request",
+			env: map[string]string{
+				"JENKINS_URL": "https://jenkins.example.com/",
+				"CHANGE_ID":   "123",
+				"BRANCH_NAME": "PR-123",
+				"GIT_URL":     "git@github.com:myorg/myproject.git",
+			},
+			expectedProvider: "Jenkins",
+			expected:         ciBuildSettings{false, "", false, false},
+		},
+		{
+			name: "Jenkins default branch",
+			env: map[string]string{
+				"JENKINS_URL": "https://jenkins.example.com/",
+				"GIT_BRANCH":  "origin/main",
+				"GIT_URL":     "https://github.com/myorg/myproject.git",
+			},
+			expectedProvider: "Jenkins",
+			expected:         ciBuildSettings{true, "https://github.com/myorg/myproject", true, false},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			provider := resolveCIProvider(fakeEnv(tc.env))
+			assert.Equal(t, provider.Name(), tc.expectedProvider)
+
+			settings, err := provider.BuildSettings()
+			assert.Ok(t, err)
+			assert.Equal(t, *settings, tc.expected)
+		})
+	}
+}
+
+func TestCIProviderLogLineGroupAndAnnotation(t *testing.T) {
+	github := resolveCIProvider(fakeEnv(map[string]string{"GITHUB_ACTIONS": "true"}))
+
+	start, end := github.LogLineGroup("default/build > pull")
+	assert.Equal(t, start, "::group::default/build > pull")
+	assert.Equal(t, end(), "::endgroup::")
+	assert.Equal(t, github.Annotation(annotationLevelError, "line1\nline2"), "::error::line1%0Aline2")
+
+	gitLab := resolveCIProvider(fakeEnv(map[string]string{"GITLAB_CI": "true"}))
+
+	start, end = gitLab.LogLineGroup("default/build > pull")
+	assert.Matches(t, start, "^\x1b\\[0Ksection_start:[0-9]+:bob_section_1\\[collapsed=true\\]\r\x1b\\[0Kdefault/build > pull$")
+	assert.Matches(t, end(), "^\x1b\\[0Ksection_end:[0-9]+:bob_section_1\r\x1b\\[0K$")
+	assert.Equal(t, gitLab.Annotation(annotationLevelWarning, "summary failed"), "WARNING: summary failed")
+
+	start, _ = resolveCIProvider(fakeEnv(map[string]string{"DRONE": "true"})).LogLineGroup("default/build > pull")
+	assert.Equal(t, start, "")
+}
+
+func TestResolveCIProviderNotInCI(t *testing.T) {
+	assert.Equal(t, resolveCIProvider(fakeEnv(map[string]string{})) == nil, true)
+}
+
+func fakeEnv(envs map[string]string) func(string) string {
+	return func(key string) string {
+		return envs[key]
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+// Container runtime abstraction (Docker or Podman). interactive stuff (dev shells, language servers)
+// uses the runtime's CLI directly.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+var (
+	errContainerRuntimeNotFound = errors.New("not found") // image / container / file not found
+)
+
+// builder exited with non-zero code
+type containerExitError struct {
+	exitCode int
+}
+
+func (c *containerExitError) Error() string {
+	return fmt.Sprintf("exit status %d", c.exitCode)
+}
+
+func (c *containerExitError) ExitCode() int {
+	return c.exitCode
+}
+
+type containerImage struct {
+	ID          string   // "sha256:..." (= digest of image config)
+	RepoDigests []string // "fn61/buildkit-golang@sha256:...". empty for local-only images
+	User        string   // containers' default user, like "node", "1000" or "1000:1000". empty = root
+}
+
+type containerRunSpec struct {
+	Name    string   // container name
+	Image   string   // image ref
+	Command []string // entrypoint of the image is turned off, so this is the full command
+	Env     []string // "KEY=value"
+	Binds   []string // "/host/path:/container/path"
+	Workdir string   // empty = image's default
+}
+
+type imageBuildSpec struct {
+	DockerfilePath string
+	ContextDir     string
+	Tags           []string // first is the primary tag
+	Platforms      []string // empty = currently running platform
+	Annotations    []string // "key=value"
+	SBOM           bool     // attach SBOM attestation
+	Provenance     string   // attach provenance attestation. "" | "min" | "max"
+	Push           bool
+}
+
+// operations Bob needs for running builds
+type ContainerRuntime interface {
+	Name() string
+	// binary for commands we run interactively (dev shells, language servers)
+	CLI() string
+	// for `--user` of dev containers. empty = image's default
+	DevContainerUser() string
+	// false (without error) if container not found
+	ContainerRunning(ctx context.Context, containerName string) (bool, error)
+	// error is errContainerRuntimeNotFound if we don't have the image locally
+	ImageInspect(ctx context.Context, imageRef string) (*containerImage, error)
+	// human-readable progress is written to *progress*
+	PullImage(ctx context.Context, imageRef string, progress io.Writer) error
+	// *contextDir* empty means the Dockerfile doesn't need a build context
+	BuildImage(ctx context.Context, tag string, dockerfilePath string, contextDir string, output io.Writer) error
+	// runs container to completion (container gets removed). output is streamed to *output* as if from a TTY.
+	// non-zero exit is returned as *containerExitError. container is stopped if *ctx* is canceled.
+	RunContainer(ctx context.Context, spec containerRunSpec, output io.Writer) error
+	// builds (possibly multi-platform) image and pushes it if requested. returns image digest (can be empty if not pushed).
+	BuildAndPushImage(ctx context.Context, spec imageBuildSpec, output io.Writer) (string, error)
+	RegistryLogin(ctx context.Context, registry string, username string, password string) error
+	// reads a file from an image without running a container from it.
+	// error is errContainerRuntimeNotFound if the image doesn't have the file.
+	ReadFileFromImage(ctx context.Context, imageRef string, path string) ([]byte, error)
+	// runtime is on another machine (like Docker-in-Docker in CI), so binds refer to *its* filesystem
+	Remote() bool
+}
+
+type containerRuntimeKind string
+
+const (
+	containerRuntimeKindDocker containerRuntimeKind = "docker"
+	containerRuntimeKindPodman containerRuntimeKind = "podman"
+)
+
+// *configured* is from user config (can be empty). if not configured, we prefer Docker if it seems
+// to be available and otherwise use Podman if it seems to be available.
+func resolveContainerRuntimeKind(configured string, getenv func(string) string, fileExists func(string) bool) (containerRuntimeKind, error) {
+	switch containerRuntimeKind(configured) {
+	case containerRuntimeKindDocker, containerRuntimeKindPodman:
+		return containerRuntimeKind(configured), nil
+	case "":
+		// autodetect below
+	default:
+		return "", fmt.Errorf("unsupported container_runtime: %s", configured)
+	}
+
+	switch {
+	case getenv("DOCKER_HOST") != "" || fileExists(dockerDefaultSocket):
+		return containerRuntimeKindDocker, nil
+	case getenv("CONTAINER_HOST") != "" || fileExists(podmanSocket(getenv)):
+		return containerRuntimeKindPodman, nil
+	default:
+		return containerRuntimeKindDocker, nil // most probably not installed, but we'll give Docker-specific errors
+	}
+}
+
+// runs a container runtime's CLI command. replaceable for tests.
+type cliRunner func(ctx context.Context, stdin io.Reader, output io.Writer, args ...string) error
+
+func execCLI(ctx context.Context, stdin io.Reader, output io.Writer, args ...string) error {
+	//nolint:gosec // ok
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = stdin
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	return cmd.Run()
+}
+
+// the runtime used for builds. resolved only once. replaceable for tests.
+var currentContainerRuntime = sync.OnceValues(func() (ContainerRuntime, error) {
+	userConfig, err := loadUserconfigFile()
+	if err != nil {
+		return nil, err
+	}
+
+	kind, err := resolveContainerRuntimeKind(userConfig.ContainerRuntime, os.Getenv, func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case containerRuntimeKindPodman:
+		return newPodmanFromEnv()
+	default:
+		return newDockerEngineFromEnv()
+	}
+})
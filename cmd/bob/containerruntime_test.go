@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/versioncontrol"
+)
+
+func TestResolveContainerRuntimeKind(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		configured string
+		env        map[string]string
+		files      []string
+		expected   string
+	}{
+		{"configured wins", "podman", nil, []string{dockerDefaultSocket}, "podman"},
+		{"docker socket", "", nil, []string{dockerDefaultSocket, "/run/podman/podman.sock"}, "docker"},
+		{"DOCKER_HOST", "", map[string]string{"DOCKER_HOST": "tcp://docker:2375"}, nil, "docker"},
+		{"podman socket", "", nil, []string{"/run/podman/podman.sock"}, "podman"},
+		{"CONTAINER_HOST", "", map[string]string{"CONTAINER_HOST": "unix:///tmp/podman.sock"}, nil, "podman"},
+		{"nothing found", "", nil, nil, "docker"},
+		{"unsupported", "lxc", nil, nil, "ERROR: unsupported container_runtime: lxc"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			kind, err := resolveContainerRuntimeKind(
+				tc.configured,
+				func(key string) string { return tc.env[key] },
+				func(path string) bool {
+					for _, file := range tc.files {
+						if file == path {
+							return true
+						}
+					}
+					return false
+				})
+
+			result := string(kind)
+			if err != nil {
+				result = "ERROR: " + err.Error()
+			}
+
+			assert.Equal(t, result, tc.expected)
+		})
+	}
+}
+
+func TestBuildAndPushOneDockerImage(t *testing.T) {
+	runtime := useFakeContainerRuntime(t)
+
+	buildCtx := &BuildContext{
+		Bobfile:          &bobfile.Bobfile{ProjectName: "turbobob"},
+		PublishArtefacts: true,
+		RevisionID:       &versioncontrol.RevisionID{RevisionID: "2c9cd41a", FriendlyRevisionID: "20250718_1205_2c9cd41a"},
+		RepositoryURL:    "https://github.com/function61/turbobob",
+		IsDefaultBranch:  true,
+	}
+
+	output, err := buildAndPushOneDockerImage(context.Background(), bobfile.DockerImageSpec{
+		Image:          "ghcr.io/function61/turbobob",
+		DockerfilePath: "subdir/Dockerfile",
+		Platforms:      []string{"linux/amd64", "linux/arm64"},
+		TagLatest:      true,
+	}, buildCtx)
+	assert.Ok(t, err)
+
+	assert.Equal(t, len(runtime.builds), 1)
+	spec := runtime.builds[0]
+	assert.Equal(t, strings.Join(spec.Tags, ","), "ghcr.io/function61/turbobob:20250718_1205_2c9cd41a,ghcr.io/function61/turbobob:latest")
+	assert.Equal(t, strings.Join(spec.Platforms, ","), "linux/amd64,linux/arm64")
+	assert.Equal(t, spec.ContextDir, "subdir")
+	assert.Equal(t, spec.Push, true)
+	assert.Equal(t, spec.Annotations[0], "org.opencontainers.image.title=turbobob")
+	assert.Equal(t, output.digest, "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592")
+
+	// fast build => currently running platform. non-default branch => no latest tag
+	buildCtx.FastBuild = true
+	buildCtx.IsDefaultBranch = false
+	buildCtx.PublishArtefacts = false
+
+	_, err = buildAndPushOneDockerImage(context.Background(), bobfile.DockerImageSpec{
+		Image:     "ghcr.io/function61/turbobob",
+		Platforms: []string{"linux/amd64", "linux/arm64"},
+		TagLatest: true,
+	}, buildCtx)
+	assert.Ok(t, err)
+
+	spec = runtime.builds[1]
+	assert.Equal(t, strings.Join(spec.Tags, ","), "ghcr.io/function61/turbobob:20250718_1205_2c9cd41a")
+	assert.Equal(t, len(spec.Platforms), 0)
+	assert.Equal(t, spec.Push, false)
+}
+
+func TestLoginToDockerRegistry(t *testing.T) {
+	runtime := useFakeContainerRuntime(t)
+
+	t.Setenv("DOCKER_CREDS", "joonas:hunter2")
+
+	cache := newDockerRegistryLoginCache()
+
+	for _, image := range []string{"ghcr.io/function61/turbobob", "ghcr.io/function61/varasto", "function61/turbobob"} {
+		assert.Ok(t, loginToDockerRegistry(context.Background(), bobfile.DockerImageSpec{Image: image}, cache))
+	}
+
+	// second login to ghcr.io was cached
+	assert.Equal(t, strings.Join(runtime.logins, "\n"), "joonas@ghcr.io\njoonas@docker.io")
+}
+
+func TestLoginToDockerRegistryPerRegistryCredentials(t *testing.T) {
+	runtime := useFakeContainerRuntime(t)
+
+	t.Setenv("DOCKER_CREDS", "joonas:hunter2")
+	t.Setenv("DOCKER_CREDS_GHCR", "function61-bot:ghp_hunter2")
+	t.Setenv("DOCKER_CREDS_GHCR_OTHER", "joonas:ghp_hunter3")
+
+	cache := newDockerRegistryLoginCache()
+
+	for _, image := range []bobfile.DockerImageSpec{
+		{Image: "function61/turbobob"},
+		{Image: "ghcr.io/function61/turbobob", CredsEnv: "DOCKER_CREDS_GHCR"},
+		{Image: "function61/varasto"},
+		{Image: "ghcr.io/function61/varasto", CredsEnv: "DOCKER_CREDS_GHCR_OTHER"},
+		{Image: "ghcr.io/function61/edgerouter", CredsEnv: "DOCKER_CREDS_GHCR"}, // previous login replaced this one
+	} {
+		assert.Ok(t, loginToDockerRegistry(context.Background(), image, cache))
+	}
+
+	assert.Equal(t, strings.Join(runtime.logins, "\n"), strings.Join([]string{
+		"joonas@docker.io",
+		"function61-bot@ghcr.io",
+		"joonas@ghcr.io",
+		"function61-bot@ghcr.io",
+	}, "\n"))
+}
+
+type fakeContainerRuntime struct {
+	ContainerRuntime // methods we don't fake panic (nil interface)
+	builds           []imageBuildSpec
+	logins           []string // "username@registry"
+}
+
+func (f *fakeContainerRuntime) BuildAndPushImage(_ context.Context, spec imageBuildSpec, _ io.Writer) (string, error) {
+	f.builds = append(f.builds, spec)
+	return "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592", nil
+}
+
+func (f *fakeContainerRuntime) RegistryLogin(_ context.Context, registry string, username string, _ string) error {
+	f.logins = append(f.logins, username+"@"+registry)
+	return nil
+}
+
+func useFakeContainerRuntime(t *testing.T) *fakeContainerRuntime {
+	t.Helper()
+
+	fake := &fakeContainerRuntime{}
+
+	original := currentContainerRuntime
+	currentContainerRuntime = func() (ContainerRuntime, error) { return fake, nil }
+	t.Cleanup(func() { currentContainerRuntime = original })
+
+	return fake
+}
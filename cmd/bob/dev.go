@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -15,7 +16,7 @@ import (
 	"github.com/spf13/cobra"
 )
 
-func devCommand(builderName string, envsAreRequired bool, ignoreNag bool) ([]string, error) {
+func devCommand(ctx context.Context, builderName string, envsAreRequired bool, ignoreNag bool) ([]string, error) {
 	bobfile, err := bobfile.Read()
 	if err != nil {
 		return nil, err
@@ -73,10 +74,20 @@ func devCommand(builderName string, envsAreRequired bool, ignoreNag bool) ([]str
 
 	useShim := true // TODO: always use?
 
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	devContainerRunning, err := isDevContainerRunning(ctx, containerName)
+	if err != nil {
+		return nil, err
+	}
+
 	var dockerCmd []string
-	if isDevContainerRunning(containerName) {
+	if devContainerRunning {
 		dockerCmd = []string{
-			"docker",
+			containerRuntime.CLI(),
 			"exec",
 			"--interactive",
 			"--tty"}
@@ -101,23 +112,29 @@ func devCommand(builderName string, envsAreRequired bool, ignoreNag bool) ([]str
 		// only need to build if a builder is dockerfile. images are ready for consumption.
 		if builderType == builderUsesTypeDockerfile {
 			// internally prints heading
-			if err := buildBuilder(bobfile, builder); err != nil {
+			if err := buildBuilder(ctx, bobfile, builder); err != nil {
 				return nil, err
 			}
 		}
 
 		dockerCmd = []string{
-			"docker",
+			containerRuntime.CLI(),
 			"run",
 			"--rm",
 			"--interactive",
 			"--tty",
-			"--user", fmt.Sprintf("0:%d", os.Getgid()), // root user for now, but use user's group so we have a chance at having sane group permissions
+		}
+
+		if user := containerRuntime.DevContainerUser(); user != "" {
+			dockerCmd = append(dockerCmd, "--user", user)
+		}
+
+		dockerCmd = append(dockerCmd,
 			"--name", containerName,
 			"--entrypoint=", // turn off possible "arg mode" in base image (our cmd would just be args to entrypoint)
-			"--volume", wd + "/" + builder.MountSource + ":" + builder.MountDestination,
+			"--volume", wd+"/"+builder.MountSource+":"+builder.MountDestination,
 			"--volume", "/tmp/build:/tmp/build", // cannot map to /tmp because at least apt won't work (permission issues?)
-		}
+		)
 
 		enableLanguageServerSupport := true
 		if enableLanguageServerSupport {
@@ -237,7 +254,7 @@ func devEntry() *cobra.Command {
 			}
 
 			osutil.ExitIfError(func() error {
-				dockerCommand, err := devCommand(builderName, !norequireEnvs, ignoreNag)
+				dockerCommand, err := devCommand(context.Background(), builderName, !norequireEnvs, ignoreNag)
 				if err != nil {
 					return err
 				}
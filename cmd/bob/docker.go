@@ -1,27 +1,28 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"strings"
 
-	. "github.com/function61/gokit/builtin"
 	"github.com/function61/turbobob/pkg/bobfile"
 	"github.com/function61/turbobob/pkg/dockertag"
 	"github.com/function61/turbobob/pkg/versioncontrol"
+	"github.com/samber/lo"
 )
 
-func isDevContainerRunning(containerName string) bool {
-	result, err := exec.Command("docker", "inspect", "-f", "{{.State.Running}}", containerName).CombinedOutput()
+func isDevContainerRunning(ctx context.Context, containerName string) (bool, error) {
+	containerRuntime, err := currentContainerRuntime()
 	if err != nil {
-		// TODO: check for other errors
-		return false
+		return false, err
 	}
 
-	return strings.TrimRight(string(result), "\n") == "true"
+	return containerRuntime.ContainerRunning(ctx, containerName)
 }
 
 func devContainerName(bobfile *bobfile.Bobfile, builder bobfile.BuilderSpec) string {
@@ -44,7 +45,7 @@ func builderImageName(projectName string, builder bobfile.BuilderSpec) string {
 	}
 }
 
-func buildBuilder(bobfile *bobfile.Bobfile, builder *bobfile.BuilderSpec) error {
+func buildBuilder(ctx context.Context, bobfile *bobfile.Bobfile, builder *bobfile.BuilderSpec) error {
 	imageName := builderImageName(bobfile.ProjectName, *builder)
 
 	builderUsesType, dockerfilePath, err := parseBuilderUsesType(builder.Uses)
@@ -58,51 +59,21 @@ func buildBuilder(bobfile *bobfile.Bobfile, builder *bobfile.BuilderSpec) error
 
 	printHeading(fmt.Sprintf("Building builder %s (as %s)", builder.Name, imageName))
 
-	imageBuildCmd, err := func() (*exec.Cmd, error) {
-		// provide Dockerfile from stdin for contextless build
-		if builder.ContextlessBuild {
-			dockerfileContent, err := os.ReadFile(dockerfilePath)
-			if err != nil {
-				return nil, err
-			}
-
-			// FIXME: would "--file -" be more semantic?
-			cmd := exec.Command(
-				"docker",
-				"build",
-				"--tag", imageName,
-				"-")
-			cmd.Stdin = bytes.NewBuffer(dockerfileContent)
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-
-			return cmd, nil
-		} else {
-			cmd := exec.Command(
-				"docker",
-				"build",
-				"--tag", imageName,
-				"--file", dockerfilePath,
-				".")
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-
-			return cmd, nil
-		}
-	}()
+	containerRuntime, err := currentContainerRuntime()
 	if err != nil {
 		return err
 	}
 
-	if err := imageBuildCmd.Run(); err != nil {
-		return err
+	contextDir := "."
+	if builder.ContextlessBuild {
+		contextDir = ""
 	}
 
-	return nil
+	return containerRuntime.BuildImage(ctx, imageName, dockerfilePath, contextDir, os.Stdout)
 }
 
-func dockerRelayEnvVars(
-	dockerArgs []string,
+// ENV passed to build containers, as "KEY=value" items
+func builderContainerEnvs(
 	revisionID *versioncontrol.RevisionID,
 	builder bobfile.BuilderSpec,
 	envsAreRequired bool,
@@ -110,18 +81,28 @@ func dockerRelayEnvVars(
 	fastbuild bool,
 	debug bool,
 ) ([]string, error) {
+	envs := []string{}
+
 	env := func(key, value string) {
-		dockerArgs = append(dockerArgs, "--env", key+"="+value)
+		envs = append(envs, key+"="+value)
 	}
 
 	env("FRIENDLY_REV_ID", revisionID.FriendlyRevisionID)
 	env("REV_ID", revisionID.RevisionID)
 	env("REV_ID_SHORT", revisionID.RevisionIDShort)
 
+	if revisionID.Branch != "" {
+		env("BRANCH", revisionID.Branch)
+	}
+
+	if tag := revisionTag(revisionID.Tags); tag != "" {
+		env("TAG", tag)
+	}
+
 	for _, envKey := range builder.PassEnvs {
 		envValue := os.Getenv(envKey)
 		if envValue != "" {
-			dockerArgs = append(dockerArgs, "--env", envKey)
+			env(envKey, envValue)
 		} else if envsAreRequired {
 			return nil, envVarMissingErr(envKey)
 		}
@@ -147,17 +128,58 @@ func dockerRelayEnvVars(
 		env("DEBUG", "true")
 	}
 
-	// "Always set to true when GitHub Actions is running the workflow. You can use this variable to
-	// differentiate when tests are being run locally or by GitHub Actions."
-	if runningInGitHubActions() { // relay as-is
-		env("GITHUB_ACTIONS", "true")
+	// so build containers can also detect the CI system
+	if ciProvider := currentCIProvider(); ciProvider != nil {
+		for _, envKey := range ciProvider.EnvsToRelay() {
+			if envValue := os.Getenv(envKey); envValue != "" { // relay as-is
+				env(envKey, envValue)
+			}
+		}
+	}
+
+	return envs, nil
+}
+
+// inserts ["--env", "FOO=bar"] pairs to `$ docker run` args
+func dockerRelayEnvVars(
+	dockerArgs []string,
+	revisionID *versioncontrol.RevisionID,
+	builder bobfile.BuilderSpec,
+	envsAreRequired bool,
+	osArches bobfile.OsArchesSpec,
+	fastbuild bool,
+	debug bool,
+) ([]string, error) {
+	envs, err := builderContainerEnvs(revisionID, builder, envsAreRequired, osArches, fastbuild, debug)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, keyValue := range envs {
+		key, _, _ := strings.Cut(keyValue, "=")
+
+		if lo.Contains(builder.PassEnvs, key) {
+			// Docker reads the value from its ENV, so secrets don't show up in our process list
+			dockerArgs = append(dockerArgs, "--env", key)
+		} else {
+			dockerArgs = append(dockerArgs, "--env", keyValue)
+		}
 	}
 
 	return dockerArgs, nil
 }
 
-func loginToDockerRegistry(dockerImage bobfile.DockerImageSpec, cache *dockerRegistryLoginCache) error {
-	credentialsObtainer := getDockerCredentialsObtainer(dockerImage)
+func loginToDockerRegistry(ctx context.Context, dockerImage bobfile.DockerImageSpec, cache *dockerRegistryLoginCache) error {
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return err
+	}
+
+	credentialsObtainer, err := getDockerCredentialsObtainer(dockerImage)
+	if err != nil {
+		return err
+	}
+
 	creds, err := credentialsObtainer.Obtain()
 	if err != nil {
 		return err
@@ -177,66 +199,96 @@ func loginToDockerRegistry(dockerImage bobfile.DockerImageSpec, cache *dockerReg
 		registryDefaulted = dockertag.DockerHubHostname // docker.io
 	}
 
-	cacheKey := newDockerRegistryLoginCacheKey(registryDefaulted, *creds)
-
-	if cache.Cached(cacheKey) {
+	if cache.LoggedIn(registryDefaulted, *creds) {
 		return nil
 	}
 
 	printHeading(fmt.Sprintf("Logging in as %s to %s", creds.Username, registryDefaulted))
 
-	//nolint:gosec // ok
-	loginCmd := passthroughStdoutAndStderr(exec.Command(
-		"docker",
-		"login",
-		"--username", creds.Username,
-		"--password", creds.Password,
-		registryDefaulted))
-
-	if err := loginCmd.Run(); err != nil {
+	if err := containerRuntime.RegistryLogin(ctx, registryDefaulted, creds.Username, creds.Password); err != nil {
 		return err
 	}
 
-	cache.Cache(cacheKey)
+	cache.Remember(registryDefaulted, *creds)
 
 	return nil
 }
 
-func dockerPullIfRequired(imageRef string) error {
-	// there's no flag to "$ docker pull" that could allow us to say "please don't check the registry
-	// for newest version of that tag if we already have any version", so let's first query Docker
-	// if we already have the image, in order to not query the registry many times. use cases:
+func dockerPullIfRequired(ctx context.Context, imageRef string, progress io.Writer) error {
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return err
+	}
+
+	// there's no way to say "please don't check the registry for newest version of that tag if we
+	// already have any version", so let's first query if we already have the image, in order to
+	// not query the registry many times. use cases:
 	// - repeated "$ bob build" invocations
 	// - same builder used multiple times in the project
-	alreadyHave := exec.Command("docker", "image", "inspect", imageRef).Run()
-	if alreadyHave == nil { // this has error if we don't have the image yet
+	if _, err := containerRuntime.ImageInspect(ctx, imageRef); err == nil {
 		return nil
+	} else if !errors.Is(err, errContainerRuntimeNotFound) {
+		return err
 	}
 
-	return passthroughStdoutAndStderr(exec.Command("docker", "pull", imageRef)).Run()
-}
-
-type dockerRegistryLoginCacheKey string
-
-func newDockerRegistryLoginCacheKey(registry string, creds DockerCredentials) dockerRegistryLoginCacheKey {
-	return dockerRegistryLoginCacheKey(fmt.Sprintf("%s:%s:%s", registry, creds.Username, creds.Password))
+	return containerRuntime.PullImage(ctx, imageRef, progress)
 }
 
+// tracks the credentials we're currently logged in with to each registry. the runtime stores only one
+// login per registry, so logging in with different credentials replaces the previous login.
 type dockerRegistryLoginCache struct {
-	items map[dockerRegistryLoginCacheKey]Void
+	loggedIn map[string]string // registry => fingerprint of credentials
 }
 
 func newDockerRegistryLoginCache() *dockerRegistryLoginCache {
 	return &dockerRegistryLoginCache{
-		items: map[dockerRegistryLoginCacheKey]Void{},
+		loggedIn: map[string]string{},
 	}
 }
 
-func (d *dockerRegistryLoginCache) Cached(key dockerRegistryLoginCacheKey) bool {
-	_, cached := d.items[key]
-	return cached
+func (d *dockerRegistryLoginCache) LoggedIn(registry string, creds DockerCredentials) bool {
+	return d.loggedIn[registry] == dockerCredentialsFingerprint(creds)
+}
+
+func (d *dockerRegistryLoginCache) Remember(registry string, creds DockerCredentials) {
+	d.loggedIn[registry] = dockerCredentialsFingerprint(creds)
 }
 
-func (d *dockerRegistryLoginCache) Cache(key dockerRegistryLoginCacheKey) {
-	d.items[key] = Void{}
+// so we don't keep the password around in plaintext
+func dockerCredentialsFingerprint(creds DockerCredentials) string {
+	digest := sha256.Sum256([]byte(creds.Username + "\x00" + creds.Password))
+	return hex.EncodeToString(digest[:])
+}
+
+// prefers registry digest ("fn61/buildkit-golang@sha256:...") but local-only images only have the image ID ("sha256:...")
+func dockerImageDigest(ctx context.Context, imageRef string) (string, error) {
+	image, err := dockerImageInspect(ctx, imageRef)
+	if err != nil {
+		return "", fmt.Errorf("dockerImageDigest: %w", err)
+	}
+
+	if len(image.RepoDigests) > 0 {
+		return image.RepoDigests[0], nil
+	}
+
+	return image.ID, nil
+}
+
+// local image ID (= digest of image config), like "sha256:d7a8fbb3...". changes whenever image content changes.
+func dockerImageID(ctx context.Context, imageRef string) (string, error) {
+	image, err := dockerImageInspect(ctx, imageRef)
+	if err != nil {
+		return "", fmt.Errorf("dockerImageID: %w", err)
+	}
+
+	return image.ID, nil
+}
+
+func dockerImageInspect(ctx context.Context, imageRef string) (*containerImage, error) {
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return nil, err
+	}
+
+	return containerRuntime.ImageInspect(ctx, imageRef)
 }
@@ -1,11 +1,17 @@
 package main
 
 import (
-	"errors"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/dockertag"
 )
 
 type DockerCredentials struct {
@@ -18,36 +24,202 @@ type DockerCredentialObtainer interface {
 	Obtain() (*DockerCredentials, error)
 }
 
-type credsFromENV struct{}
+type credsFromENV struct {
+	envKey string // "DOCKER_CREDS" | "DOCKER_CREDS_GHCR" | ...
+}
 
 var credsFromENVRe = regexp.MustCompile("^([^:]+):(.+)$")
 
 func (d *credsFromENV) Obtain() (*DockerCredentials, error) {
-	serialized := os.Getenv("DOCKER_CREDS")
+	serialized := os.Getenv(d.envKey)
 	if serialized == "" {
 		return nil, nil
 	}
 
-	credsParts := credsFromENVRe.FindStringSubmatch(serialized)
-	if len(credsParts) != 3 {
-		return nil, bobfile.ErrInvalidDockerCredsEnvFormat
+	creds := parseDockerCredentials(serialized)
+	if creds == nil {
+		return nil, fmt.Errorf("%s: %w", d.envKey, bobfile.ErrInvalidDockerCredsEnvFormat)
+	}
+
+	return creds, nil
+}
+
+// same "username:password" format as in $DOCKER_CREDS
+type credsFromFile struct {
+	path string
+}
+
+func (d *credsFromFile) Obtain() (*DockerCredentials, error) {
+	serialized, err := os.ReadFile(d.path)
+	if err != nil {
+		return nil, fmt.Errorf("credsFromFile: %w", err)
+	}
+
+	creds := parseDockerCredentials(strings.TrimSpace(string(serialized)))
+	if creds == nil {
+		return nil, fmt.Errorf("credsFromFile: %s: invalid format, expecting username:password", d.path)
+	}
+
+	return creds, nil
+}
+
+// credentials stored by "$ docker login" (directly in config.json or via a credential helper)
+type credsFromDockerConfig struct {
+	registry string // key in config.json
+}
+
+func (d *credsFromDockerConfig) Obtain() (*DockerCredentials, error) {
+	return dockerConfigCredentials(d.registry)
+}
+
+// GitHub Actions' automatic token. can push to ghcr.io if the workflow has `packages: write` permission.
+type credsFromGitHubToken struct{}
+
+func (d *credsFromGitHubToken) Obtain() (*DockerCredentials, error) {
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("credsFromGitHubToken: %w (pass it from workflow: `env: GITHUB_TOKEN: ${{ secrets.GITHUB_TOKEN }}`)", envVarMissingErr("GITHUB_TOKEN"))
 	}
 
 	return &DockerCredentials{
-		Username: credsParts[1],
-		Password: credsParts[2],
+		Username: firstNonEmpty(os.Getenv("GITHUB_ACTOR"), "github-actions"), // ghcr.io doesn't care about the username
+		Password: token,
 	}, nil
 }
 
-func getDockerCredentialsObtainer(dockerImage bobfile.DockerImageSpec) DockerCredentialObtainer {
+func getDockerCredentialsObtainer(dockerImage bobfile.DockerImageSpec) (DockerCredentialObtainer, error) {
+	credsFromEnvDefaulted := &credsFromENV{envKey: firstNonEmpty(dockerImage.CredsEnv, "DOCKER_CREDS")}
+
 	if dockerImage.AuthType == nil {
-		return &credsFromENV{}
+		return credsFromEnvDefaulted, nil
 	}
 
 	switch *dockerImage.AuthType {
 	case "creds_from_env":
-		return &credsFromENV{}
+		return credsFromEnvDefaulted, nil
+	case "creds_from_file":
+		if dockerImage.AuthFile == "" {
+			return nil, fmt.Errorf("%s: auth_type creds_from_file requires auth_file", dockerImage.Image)
+		}
+
+		return &credsFromFile{path: dockerImage.AuthFile}, nil
+	case "docker_config":
+		return &credsFromDockerConfig{registry: dockerConfigRegistryKey(dockerImage.Image)}, nil
+	case "github_token":
+		if tag := dockertag.Parse(dockerImage.Image); tag == nil || tag.Registry != "ghcr.io" {
+			return nil, fmt.Errorf("%s: auth_type github_token only works with ghcr.io", dockerImage.Image)
+		}
+
+		return &credsFromGitHubToken{}, nil
 	default:
-		panic(errors.New("invalid AuthType: " + *dockerImage.AuthType))
+		return nil, fmt.Errorf("%s: invalid auth_type: %s", dockerImage.Image, *dockerImage.AuthType)
 	}
 }
+
+// "username:password" => creds. nil if invalid format.
+func parseDockerCredentials(serialized string) *DockerCredentials {
+	credsParts := credsFromENVRe.FindStringSubmatch(serialized)
+	if len(credsParts) != 3 {
+		return nil
+	}
+
+	return &DockerCredentials{
+		Username: credsParts[1],
+		Password: credsParts[2],
+	}
+}
+
+// key of the image's registry in Docker's config.json
+func dockerConfigRegistryKey(imageRef string) string {
+	tag := dockertag.Parse(imageRef)
+	if tag == nil || tag.Registry == "" || tag.Registry == dockertag.DockerHubHostname {
+		return "https://index.docker.io/v1/" // Docker Hub's key in config, for historical reasons
+	}
+
+	return tag.Registry
+}
+
+// nil (without error) if not logged in to *registry*
+func dockerConfigCredentials(registry string) (*DockerCredentials, error) {
+	withErr := func(err error) (*DockerCredentials, error) { return nil, fmt.Errorf("dockerConfigCredentials: %w", err) }
+
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return withErr(err)
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	config := struct {
+		Auths map[string]struct {
+			Auth string `json:"auth"` // base64("username:password")
+		} `json:"auths"`
+		CredsStore  string            `json:"credsStore"`
+		CredHelpers map[string]string `json:"credHelpers"` // registry => helper
+	}{}
+	configJSON, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		if os.IsNotExist(err) { // never logged in anywhere
+			return nil, nil
+		}
+
+		return withErr(err)
+	}
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return withErr(err)
+	}
+
+	if helper := firstNonEmpty(config.CredHelpers[registry], config.CredsStore); helper != "" {
+		creds, err := dockerCredentialHelperGet(helper, registry)
+		if err != nil {
+			return withErr(err)
+		}
+
+		return creds, nil
+	}
+
+	auth, found := config.Auths[registry]
+	if !found || auth.Auth == "" {
+		return nil, nil
+	}
+
+	usernameAndPassword, err := base64.StdEncoding.DecodeString(auth.Auth)
+	if err != nil {
+		return withErr(err)
+	}
+
+	username, password, _ := strings.Cut(string(usernameAndPassword), ":")
+	return &DockerCredentials{Username: username, Password: password}, nil
+}
+
+// https://github.com/docker/docker-credential-helpers
+func dockerCredentialHelperGet(helper string, registry string) (*DockerCredentials, error) {
+	//nolint:gosec // helper name comes from user's Docker config
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+
+	output, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(string(output), "credentials not found") { // not an error, we'll just not log in
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("docker-credential-%s: %w: %s", helper, err, output)
+	}
+
+	creds := struct {
+		Username string `json:"Username"`
+		Secret   string `json:"Secret"`
+	}{}
+	if err := json.Unmarshal(output, &creds); err != nil {
+		return nil, err
+	}
+
+	if creds.Username == "" {
+		return nil, nil
+	}
+
+	return &DockerCredentials{Username: creds.Username, Password: creds.Secret}, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+)
+
+func TestGetDockerCredentialsObtainer(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "registry-creds")
+	assert.Ok(t, os.WriteFile(authFile, []byte("joonas:hunter2\n"), 0600))
+
+	dockerConfigDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", dockerConfigDir)
+	assert.Ok(t, os.WriteFile(filepath.Join(dockerConfigDir, "config.json"), []byte(`{
+	"auths": {
+		"https://index.docker.io/v1/": {"auth": "am9vbmFzOmh1bnRlcjI="}
+	}
+}`), 0600))
+
+	t.Setenv("DOCKER_CREDS", "joonas:hunter2")
+	t.Setenv("GITHUB_TOKEN", "ghs_hunter2")
+	t.Setenv("GITHUB_ACTOR", "joonas")
+
+	authType := func(authType string) *string { return &authType }
+
+	for _, tc := range []struct {
+		name     string
+		image    bobfile.DockerImageSpec
+		expected string
+	}{
+		{"default", bobfile.DockerImageSpec{Image: "joonas/app"}, "joonas:hunter2"},
+		{"creds_from_env", bobfile.DockerImageSpec{Image: "joonas/app", AuthType: authType("creds_from_env")}, "joonas:hunter2"},
+		{"creds_from_file", bobfile.DockerImageSpec{Image: "joonas/app", AuthType: authType("creds_from_file"), AuthFile: authFile}, "joonas:hunter2"},
+		{"creds_from_file without file", bobfile.DockerImageSpec{Image: "joonas/app", AuthType: authType("creds_from_file")}, "ERROR: joonas/app: auth_type creds_from_file requires auth_file"},
+		{"docker_config", bobfile.DockerImageSpec{Image: "joonas/app", AuthType: authType("docker_config")}, "joonas:hunter2"},
+		{"docker_config not logged in", bobfile.DockerImageSpec{Image: "ghcr.io/joonas/app", AuthType: authType("docker_config")}, "(none)"},
+		{"github_token", bobfile.DockerImageSpec{Image: "ghcr.io/joonas/app", AuthType: authType("github_token")}, "joonas:ghs_hunter2"},
+		{"github_token wrong registry", bobfile.DockerImageSpec{Image: "joonas/app", AuthType: authType("github_token")}, "ERROR: joonas/app: auth_type github_token only works with ghcr.io"},
+		{"unknown", bobfile.DockerImageSpec{Image: "joonas/app", AuthType: authType("magic")}, "ERROR: joonas/app: invalid auth_type: magic"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, obtainDockerCredentialsForTest(tc.image), tc.expected)
+		})
+	}
+}
+
+func obtainDockerCredentialsForTest(image bobfile.DockerImageSpec) string {
+	obtainer, err := getDockerCredentialsObtainer(image)
+	if err != nil {
+		return "ERROR: " + err.Error()
+	}
+
+	creds, err := obtainer.Obtain()
+	switch {
+	case err != nil:
+		return "ERROR: " + err.Error()
+	case creds == nil:
+		return "(none)"
+	default:
+		return creds.Username + ":" + creds.Password
+	}
+}
@@ -0,0 +1,595 @@
+package main
+
+// Docker Engine API client. we only need a handful of endpoints, so instead of pulling in the
+// official (huge) client we use plain HTTP.
+//
+// https://docs.docker.com/reference/api/engine/version/v1.41/
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/function61/gokit/app/udocker"
+	"github.com/function61/gokit/encoding/jsonfile"
+	"github.com/function61/gokit/net/http/ezhttp"
+)
+
+const (
+	dockerEngineAPIVersion = "v1.41" // Docker 20.10+
+	dockerDefaultSocket    = "/var/run/docker.sock"
+)
+
+type dockerEngine struct {
+	client  *http.Client
+	baseURL string // "http://localhost"
+	runCLI  cliRunner
+	remote  bool
+}
+
+var _ ContainerRuntime = (*dockerEngine)(nil)
+
+// honors $DOCKER_HOST (and $DOCKER_TLS_VERIFY, $DOCKER_CERT_PATH) like the `docker` CLI does
+func newDockerEngineFromEnv() (*dockerEngine, error) {
+	withErr := func(err error) (*dockerEngine, error) { return nil, fmt.Errorf("newDockerEngineFromEnv: %w", err) }
+
+	dockerHost := firstNonEmpty(os.Getenv("DOCKER_HOST"), "unix://"+dockerDefaultSocket)
+
+	dockerHostURL, err := url.Parse(dockerHost)
+	if err != nil {
+		return withErr(err)
+	}
+
+	switch dockerHostURL.Scheme {
+	case "unix":
+		client, baseURL, err := udocker.Client(dockerHost, nil, false)
+		if err != nil {
+			return withErr(err)
+		}
+
+		return &dockerEngine{client: client, baseURL: baseURL, runCLI: execCLI}, nil
+	case "tcp":
+		remote := !isLoopbackHost(dockerHostURL.Hostname())
+
+		if os.Getenv("DOCKER_TLS_VERIFY") == "" {
+			return &dockerEngine{client: http.DefaultClient, baseURL: "http://" + dockerHostURL.Host, runCLI: execCLI, remote: remote}, nil
+		}
+
+		tlsConfig, err := dockerTLSConfigFromEnv()
+		if err != nil {
+			return withErr(err)
+		}
+
+		return &dockerEngine{
+			client:  &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}},
+			baseURL: "https://" + dockerHostURL.Host,
+			runCLI:  execCLI,
+			remote:  remote,
+		}, nil
+	default:
+		return withErr(fmt.Errorf("unsupported DOCKER_HOST: %s", dockerHost))
+	}
+}
+
+func (d *dockerEngine) Name() string {
+	return "Docker"
+}
+
+func (d *dockerEngine) CLI() string {
+	return "docker"
+}
+
+// root user for now, but use user's group so we have a chance at having sane group permissions
+func (d *dockerEngine) DevContainerUser() string {
+	return fmt.Sprintf("0:%d", os.Getgid())
+}
+
+func (d *dockerEngine) Remote() bool {
+	return d.remote
+}
+
+func (d *dockerEngine) ContainerRunning(ctx context.Context, containerName string) (bool, error) {
+	container := struct {
+		State struct {
+			Running bool `json:"Running"`
+		} `json:"State"`
+	}{}
+	if _, err := ezhttp.Get(
+		ctx,
+		d.url("/containers/"+url.PathEscape(containerName)+"/json", nil),
+		ezhttp.Client(d.client),
+		ezhttp.RespondsJSONAllowUnknownFields(&container),
+	); err != nil {
+		if ezhttp.ErrorIs(err, http.StatusNotFound) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("ContainerRunning: %w", err)
+	}
+
+	return container.State.Running, nil
+}
+
+func (d *dockerEngine) ImageInspect(ctx context.Context, imageRef string) (*containerImage, error) {
+	image := struct {
+		ID          string   `json:"Id"`
+		RepoDigests []string `json:"RepoDigests"`
+		Config      struct {
+			User string `json:"User"`
+		} `json:"Config"`
+	}{}
+	if _, err := ezhttp.Get(
+		ctx,
+		d.url("/images/"+imageRef+"/json", nil), // not escaped, because slashes are part of the name
+		ezhttp.Client(d.client),
+		ezhttp.RespondsJSONAllowUnknownFields(&image),
+	); err != nil {
+		if ezhttp.ErrorIs(err, http.StatusNotFound) {
+			return nil, fmt.Errorf("ImageInspect: %s: %w", imageRef, errContainerRuntimeNotFound)
+		}
+
+		return nil, fmt.Errorf("ImageInspect: %w", err)
+	}
+
+	return &containerImage{ID: image.ID, RepoDigests: image.RepoDigests, User: image.Config.User}, nil
+}
+
+func (d *dockerEngine) PullImage(ctx context.Context, imageRef string, progress io.Writer) error {
+	withErr := func(err error) error { return fmt.Errorf("PullImage: %s: %w", imageRef, err) }
+
+	query := url.Values{"fromImage": {imageRef}}
+	if !imageRefHasTagOrDigest(imageRef) { // without tag the API would pull all tags
+		query.Set("tag", "latest")
+	}
+
+	registryAuth, err := dockerConfigRegistryAuth(imageRef)
+	if err != nil {
+		return withErr(err)
+	}
+
+	res, err := ezhttp.Post(
+		ctx,
+		d.url("/images/create", query),
+		ezhttp.Client(d.client),
+		ezhttp.Header("X-Registry-Auth", registryAuth))
+	if err != nil {
+		return withErr(err)
+	}
+	defer res.Body.Close()
+
+	// errors (like "manifest unknown") are reported inside the stream with 200 OK status
+	if err := dockerJSONMessagesToProgress(res.Body, progress); err != nil {
+		return withErr(err)
+	}
+
+	return nil
+}
+
+// image builds need BuildKit which requires a session protocol on top of the Engine API, so we let the CLI do it
+func (d *dockerEngine) BuildImage(ctx context.Context, tag string, dockerfilePath string, contextDir string, output io.Writer) error {
+	return buildImageWithCLI(ctx, d.runCLI, d.CLI(), tag, dockerfilePath, contextDir, output)
+}
+
+func (d *dockerEngine) BuildAndPushImage(ctx context.Context, spec imageBuildSpec, output io.Writer) (string, error) {
+	withErr := func(err error) (string, error) { return "", fmt.Errorf("BuildAndPushImage: %w", err) }
+
+	// TODO: if in CI, install buildx automatically if needed?
+
+	args := []string{
+		"docker",
+		"buildx",
+		"build",
+		"--file", spec.DockerfilePath,
+	}
+
+	for _, tag := range spec.Tags {
+		args = append(args, "--tag="+tag)
+	}
+
+	for _, platform := range spec.Platforms {
+		args = append(args, "--platform="+platform)
+	}
+
+	// https://docs.docker.com/reference/cli/docker/buildx/build/#annotation
+	// annotate both the image index and the image manifest.
+	// if we don't specify type of annotation, only the image manifest is annotated.
+	// for example GitHub packages UI only shows annotations from OCI image index.
+	for _, annotation := range spec.Annotations {
+		args = append(args, "--annotation=index,manifest:"+annotation)
+	}
+
+	// for backwards compatibility (some consumers use this), publish the annotations also as labels
+	for _, annotation := range spec.Annotations {
+		args = append(args, "--label="+annotation)
+	}
+
+	// https://docs.docker.com/build/metadata/attestations/
+	if spec.SBOM {
+		args = append(args, "--sbom=true")
+	}
+
+	if spec.Provenance != "" {
+		args = append(args, "--provenance=mode="+spec.Provenance)
+	}
+
+	// buildx writes the resulting image's digest here
+	metadataFile, err := os.CreateTemp("", "bob-buildx-metadata-*.json")
+	if err != nil {
+		return withErr(err)
+	}
+	metadataFile.Close()
+	defer os.Remove(metadataFile.Name())
+
+	args = append(args, "--metadata-file="+metadataFile.Name())
+
+	args = append(args, spec.ContextDir)
+
+	if spec.Push {
+		// the build command has integrated push support. we'd actually prefer to separate
+		// these stages, but multi-arch manifests aren't supported storing locally so we've
+		// to push immediately
+		args = append(args, "--push")
+	}
+
+	if err := d.runCLI(ctx, nil, output, args...); err != nil {
+		return withErr(err)
+	}
+
+	metadata := struct {
+		Digest string `json:"containerimage.digest"`
+	}{}
+	if err := jsonfile.ReadAllowUnknownFields(metadataFile.Name(), &metadata); err != nil {
+		return withErr(err)
+	}
+
+	return metadata.Digest, nil
+}
+
+func (d *dockerEngine) RegistryLogin(ctx context.Context, registry string, username string, password string) error {
+	// via stdin so the password isn't visible in process list
+	return d.runCLI(ctx, strings.NewReader(password), os.Stdout, "docker", "login", "--username", username, "--password-stdin", registry)
+}
+
+func (d *dockerEngine) RunContainer(ctx context.Context, spec containerRunSpec, output io.Writer) error {
+	withErr := func(err error) error { return fmt.Errorf("RunContainer: %w", err) }
+
+	containerID, err := d.createContainer(ctx, spec.Name, dockerContainerCreate{
+		Image:      spec.Image,
+		Cmd:        spec.Command,
+		Entrypoint: []string{""}, // turn off possible "arg mode" in base image (our cmd would just be args to entrypoint)
+		Env:        spec.Env,
+		WorkingDir: spec.Workdir,
+		Tty:        true, // so builders' tools output colors etc.
+		HostConfig: dockerContainerCreateHostConfig{
+			Binds: spec.Binds,
+		},
+	})
+	if err != nil {
+		return withErr(err)
+	}
+	// ctx can be canceled by now
+	defer func() { _ = d.removeContainer(context.Background(), containerID) }()
+
+	if err := closeBody(ezhttp.Post(
+		ctx,
+		d.url("/containers/"+containerID+"/start", nil),
+		ezhttp.Client(d.client),
+	)); err != nil {
+		return withErr(err)
+	}
+
+	logsDone := make(chan error, 1)
+	go func() {
+		logsDone <- d.streamLogs(ctx, containerID, output)
+	}()
+
+	waitResult := struct {
+		StatusCode int `json:"StatusCode"`
+		Error      *struct {
+			Message string `json:"Message"`
+		} `json:"Error"`
+	}{}
+	if _, err := ezhttp.Post(
+		ctx,
+		d.url("/containers/"+containerID+"/wait", nil),
+		ezhttp.Client(d.client),
+		ezhttp.RespondsJSONAllowUnknownFields(&waitResult),
+	); err != nil {
+		if ctx.Err() != nil { // canceled (e.g. another builder failed) => stop the container
+			if errKill := closeBody(ezhttp.Post(
+				context.Background(),
+				d.url("/containers/"+containerID+"/kill", nil),
+				ezhttp.Client(d.client),
+			)); errKill != nil {
+				return withErr(fmt.Errorf("%w; kill: %w", ctx.Err(), errKill))
+			}
+
+			<-logsDone
+			return ctx.Err()
+		}
+
+		return withErr(err)
+	}
+
+	// logs end when container exits. wait to not lose the last lines.
+	if err := <-logsDone; err != nil {
+		return withErr(err)
+	}
+
+	if waitResult.Error != nil && waitResult.Error.Message != "" {
+		return withErr(errors.New(waitResult.Error.Message))
+	}
+
+	if waitResult.StatusCode != 0 {
+		return &containerExitError{exitCode: waitResult.StatusCode}
+	}
+
+	return nil
+}
+
+func (d *dockerEngine) ReadFileFromImage(ctx context.Context, imageRef string, path string) ([]byte, error) {
+	withErr := func(err error) ([]byte, error) { return nil, fmt.Errorf("ReadFileFromImage: %w", err) }
+
+	// a created (but never started) container gives us access to the image's filesystem
+	containerID, err := d.createContainer(ctx, "", dockerContainerCreate{
+		Image: imageRef,
+		Cmd:   []string{"true"}, // never run, but creating requires a command if image doesn't have one
+	})
+	if err != nil {
+		return withErr(err)
+	}
+	defer func() { _ = d.removeContainer(context.Background(), containerID) }()
+
+	res, err := ezhttp.Get(
+		ctx,
+		d.url("/containers/"+containerID+"/archive", url.Values{"path": {path}}),
+		ezhttp.Client(d.client))
+	if err != nil {
+		if ezhttp.ErrorIs(err, http.StatusNotFound) {
+			return withErr(fmt.Errorf("%s: %s: %w", imageRef, path, errContainerRuntimeNotFound))
+		}
+
+		return withErr(err)
+	}
+	defer res.Body.Close()
+
+	archive := tar.NewReader(res.Body)
+	for {
+		header, err := archive.Next()
+		if err != nil {
+			if err == io.EOF {
+				return withErr(fmt.Errorf("%s: %s: not a file", imageRef, path))
+			}
+
+			return withErr(err)
+		}
+
+		if header.Typeflag == tar.TypeReg {
+			return io.ReadAll(archive)
+		}
+	}
+}
+
+type dockerContainerCreate struct {
+	Image      string                          `json:"Image"`
+	Cmd        []string                        `json:"Cmd"`
+	Entrypoint []string                        `json:"Entrypoint,omitempty"`
+	Env        []string                        `json:"Env,omitempty"`
+	WorkingDir string                          `json:"WorkingDir,omitempty"`
+	Tty        bool                            `json:"Tty"`
+	HostConfig dockerContainerCreateHostConfig `json:"HostConfig"`
+}
+
+type dockerContainerCreateHostConfig struct {
+	Binds []string `json:"Binds,omitempty"`
+}
+
+// *name* can be empty
+func (d *dockerEngine) createContainer(ctx context.Context, name string, spec dockerContainerCreate) (string, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+
+	created := struct {
+		ID string `json:"Id"`
+	}{}
+	if _, err := ezhttp.Post(
+		ctx,
+		d.url("/containers/create", query),
+		ezhttp.Client(d.client),
+		ezhttp.SendJSON(spec),
+		ezhttp.RespondsJSONAllowUnknownFields(&created),
+	); err != nil {
+		if ezhttp.ErrorIs(err, http.StatusNotFound) {
+			return "", fmt.Errorf("image %s: %w", spec.Image, errContainerRuntimeNotFound)
+		}
+
+		return "", err
+	}
+
+	return created.ID, nil
+}
+
+func (d *dockerEngine) removeContainer(ctx context.Context, containerID string) error {
+	return closeBody(ezhttp.Del(
+		ctx,
+		d.url("/containers/"+containerID, url.Values{"force": {"true"}, "v": {"true"}}),
+		ezhttp.Client(d.client)))
+}
+
+// for responses whose body we're not interested in
+func closeBody(res *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+
+	return res.Body.Close()
+}
+
+// with TTY the log stream is raw (not multiplexed into stdout / stderr frames)
+func (d *dockerEngine) streamLogs(ctx context.Context, containerID string, output io.Writer) error {
+	res, err := ezhttp.Get(
+		ctx,
+		d.url("/containers/"+containerID+"/logs", url.Values{"follow": {"true"}, "stdout": {"true"}, "stderr": {"true"}}),
+		ezhttp.Client(d.client))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if _, err := io.Copy(output, res.Body); err != nil && ctx.Err() == nil {
+		return err
+	}
+
+	return nil
+}
+
+// shared by Docker and Podman, whose `build` subcommands are compatible
+func buildImageWithCLI(ctx context.Context, runCLI cliRunner, cli string, tag string, dockerfilePath string, contextDir string, output io.Writer) error {
+	if contextDir == "" { // provide Dockerfile from stdin for contextless build
+		dockerfileContent, err := os.ReadFile(dockerfilePath)
+		if err != nil {
+			return err
+		}
+
+		// FIXME: would "--file -" be more semantic?
+		return runCLI(ctx, bytes.NewReader(dockerfileContent), output, cli, "build", "--tag", tag, "-")
+	}
+
+	return runCLI(ctx, nil, output, cli, "build", "--tag", tag, "--file", dockerfilePath, contextDir)
+}
+
+// "localhost", "127.0.0.1" and "::1" are loopback
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// "/containers/json" => "http://localhost/v1.41/containers/json"
+func (d *dockerEngine) url(path string, query url.Values) string {
+	u := d.baseURL + "/" + dockerEngineAPIVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	return u
+}
+
+type dockerJSONMessage struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Progress string `json:"progress"` // progress bar
+	Error    string `json:"error"`
+}
+
+// pull etc. respond with a stream of JSON messages. we're not interested in progress bars, only in status changes.
+func dockerJSONMessagesToProgress(stream io.Reader, progress io.Writer) error {
+	messages := json.NewDecoder(stream)
+	for {
+		msg := dockerJSONMessage{}
+		if err := messages.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+
+		switch {
+		case msg.Error != "":
+			return errors.New(msg.Error)
+		case msg.Progress != "":
+			// skip
+		case msg.ID != "":
+			fmt.Fprintf(progress, "%s: %s\n", msg.ID, msg.Status)
+		default:
+			fmt.Fprintln(progress, msg.Status)
+		}
+	}
+}
+
+// "alpine" => false
+// "alpine:latest" => true
+// "localhost:5000/alpine" => false
+func imageRefHasTagOrDigest(imageRef string) bool {
+	lastComponent := imageRef[strings.LastIndex(imageRef, "/")+1:]
+	return strings.ContainsAny(lastComponent, ":@")
+}
+
+// value for "X-Registry-Auth" header, based on credentials stored by "$ docker login". empty if none.
+func dockerConfigRegistryAuth(imageRef string) (string, error) {
+	withErr := func(err error) (string, error) { return "", fmt.Errorf("dockerConfigRegistryAuth: %w", err) }
+
+	registry := dockerConfigRegistryKey(imageRef)
+
+	creds, err := dockerConfigCredentials(registry)
+	if err != nil {
+		return withErr(err)
+	}
+
+	if creds == nil {
+		return "", nil
+	}
+
+	authJSON, err := json.Marshal(struct {
+		Username      string `json:"username"`
+		Password      string `json:"password"`
+		ServerAddress string `json:"serveraddress"`
+	}{creds.Username, creds.Password, registry})
+	if err != nil {
+		return withErr(err)
+	}
+
+	return base64.URLEncoding.EncodeToString(authJSON), nil
+}
+
+// https://docs.docker.com/engine/security/protect-access/#use-tls-https-to-protect-the-docker-daemon-socket
+func dockerTLSConfigFromEnv() (*tls.Config, error) {
+	certPath := os.Getenv("DOCKER_CERT_PATH")
+	if certPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		certPath = filepath.Join(home, ".docker")
+	}
+
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(certPath, "cert.pem"), filepath.Join(certPath, "key.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	caPEM, err := os.ReadFile(filepath.Join(certPath, "ca.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("dockerTLSConfigFromEnv: no certificates in ca.pem")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      caPool,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestDockerEngineRunContainer(t *testing.T) {
+	calls := []string{}
+	var callsMu sync.Mutex
+
+	engine, cleanup := newTestDockerEngine(t, func(w http.ResponseWriter, r *http.Request) {
+		callsMu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		callsMu.Unlock()
+
+		switch r.URL.Path {
+		case "/v1.41/containers/create":
+			create := dockerContainerCreate{}
+			assert.Ok(t, json.NewDecoder(r.Body).Decode(&create))
+			assert.Equal(t, r.URL.Query().Get("name"), "tbbuild-turbobob-default-123")
+			assert.Equal(t, strings.Join(create.Cmd, " "), "build-go-project.sh --directory=cmd/bob/")
+			assert.Equal(t, strings.Join(create.HostConfig.Binds, ","), "/project:/workspace")
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"Id": "abc123"}`))
+		case "/v1.41/containers/abc123/start":
+			w.WriteHeader(http.StatusNoContent)
+		case "/v1.41/containers/abc123/logs":
+			_, _ = w.Write([]byte("compiling\r\nFAIL\r\n"))
+		case "/v1.41/containers/abc123/wait":
+			_, _ = w.Write([]byte(`{"StatusCode": 3}`))
+		case "/v1.41/containers/abc123":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer cleanup()
+
+	output := &bytes.Buffer{}
+
+	err := engine.RunContainer(context.Background(), containerRunSpec{
+		Name:    "tbbuild-turbobob-default-123",
+		Image:   "fn61/buildkit-golang:20250718_1205_2c9cd41a",
+		Command: []string{"build-go-project.sh", "--directory=cmd/bob/"},
+		Binds:   []string{"/project:/workspace"},
+	}, output)
+
+	var exitErr *containerExitError
+	assert.Assert(t, errors.As(err, &exitErr))
+	assert.Equal(t, exitCodeFromErr(err), 3)
+	assert.Equal(t, output.String(), "compiling\r\nFAIL\r\n")
+	// container is removed also on failure. logs and wait run concurrently, so only check the ends.
+	assert.Equal(t, calls[0], "POST /v1.41/containers/create")
+	assert.Equal(t, calls[len(calls)-1], "DELETE /v1.41/containers/abc123")
+}
+
+func TestDockerEngineContainerRunning(t *testing.T) {
+	engine, cleanup := newTestDockerEngine(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.41/containers/tbdev-turbobob-default/json":
+			_, _ = w.Write([]byte(`{"State": {"Running": true}}`))
+		case "/v1.41/containers/broken/json":
+			http.Error(w, `{"message": "daemon on fire"}`, http.StatusInternalServerError)
+		default:
+			http.Error(w, `{"message": "No such container"}`, http.StatusNotFound)
+		}
+	})
+	defer cleanup()
+
+	running, err := engine.ContainerRunning(context.Background(), "tbdev-turbobob-default")
+	assert.Ok(t, err)
+	assert.Equal(t, running, true)
+
+	running, err = engine.ContainerRunning(context.Background(), "tbdev-turbobob-other")
+	assert.Ok(t, err)
+	assert.Equal(t, running, false)
+
+	// real errors are not swallowed
+	_, err = engine.ContainerRunning(context.Background(), "broken")
+	assert.Matches(t, err.Error(), "^ContainerRunning: 500 Internal Server Error; .*daemon on fire")
+}
+
+func TestDockerEngineReadFileFromImage(t *testing.T) {
+	engine, cleanup := newTestDockerEngine(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.41/containers/create":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"Id": "abc123"}`))
+		case "/v1.41/containers/abc123/archive":
+			if r.URL.Query().Get("path") != baseImageJSONLocation {
+				http.Error(w, `{"message": "Could not find the file"}`, http.StatusNotFound)
+				return
+			}
+
+			content := []byte(`{"paths_to_cache": ["/root/.cache"]}`)
+
+			archive := tar.NewWriter(w)
+			assert.Ok(t, archive.WriteHeader(&tar.Header{Name: "turbobob-baseimage.json", Typeflag: tar.TypeReg, Size: int64(len(content)), Mode: 0644}))
+			_, _ = archive.Write(content)
+			assert.Ok(t, archive.Close())
+		case "/v1.41/containers/abc123":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	defer cleanup()
+
+	content, err := engine.ReadFileFromImage(context.Background(), "fn61/buildkit-golang", baseImageJSONLocation)
+	assert.Ok(t, err)
+	assert.Equal(t, string(content), `{"paths_to_cache": ["/root/.cache"]}`)
+
+	_, err = engine.ReadFileFromImage(context.Background(), "fn61/buildkit-golang", "/nonexistent")
+	assert.Assert(t, errors.Is(err, errContainerRuntimeNotFound))
+}
+
+func TestDockerJSONMessagesToProgress(t *testing.T) {
+	progress := &bytes.Buffer{}
+
+	err := dockerJSONMessagesToProgress(strings.NewReader(`{"status": "Pulling from fn61/buildkit-golang", "id": "latest"}
+{"status": "Downloading", "progressDetail": {"current": 1}, "progress": "[=>   ]", "id": "4f4fb700ef54"}
+{"status": "Pull complete", "id": "4f4fb700ef54"}
+{"error": "unauthorized: authentication required", "errorDetail": {"message": "unauthorized: authentication required"}}`), progress)
+
+	assert.Equal(t, err.Error(), "unauthorized: authentication required")
+	assert.Equal(t, progress.String(), "latest: Pulling from fn61/buildkit-golang\n4f4fb700ef54: Pull complete\n")
+}
+
+func TestImageRefHasTagOrDigest(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected bool
+	}{
+		{"alpine", false},
+		{"alpine:latest", true},
+		{"fn61/buildkit-golang@sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592", true},
+		{"localhost:5000/alpine", false},
+		{"localhost:5000/alpine:3", true},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, imageRefHasTagOrDigest(tc.input), tc.expected)
+		})
+	}
+}
+
+func TestDockerEngineBuildAndPushImage(t *testing.T) {
+	invocation := ""
+
+	engine := &dockerEngine{runCLI: func(_ context.Context, _ io.Reader, _ io.Writer, args ...string) error {
+		invocation = strings.Join(args, " ")
+
+		for _, arg := range args {
+			if metadataFile, is := strings.CutPrefix(arg, "--metadata-file="); is {
+				return os.WriteFile(metadataFile, []byte(`{"containerimage.digest": "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592"}`), 0600)
+			}
+		}
+
+		return nil
+	}}
+
+	digest, err := engine.BuildAndPushImage(context.Background(), imageBuildSpec{
+		DockerfilePath: "Dockerfile",
+		ContextDir:     ".",
+		Tags:           []string{"ghcr.io/function61/turbobob:20250718_1205_2c9cd41a"},
+		Platforms:      []string{"linux/amd64"},
+		Annotations:    []string{"org.opencontainers.image.title=turbobob"},
+		SBOM:           true,
+		Provenance:     "max",
+		Push:           true,
+	}, io.Discard)
+	assert.Ok(t, err)
+	assert.Equal(t, digest, "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592")
+
+	assert.Equal(t, regexp.MustCompile(`--metadata-file=\S+`).ReplaceAllString(invocation, "--metadata-file=(tmp)"), "docker buildx build --file Dockerfile --tag=ghcr.io/function61/turbobob:20250718_1205_2c9cd41a --platform=linux/amd64 --annotation=index,manifest:org.opencontainers.image.title=turbobob --label=org.opencontainers.image.title=turbobob --sbom=true --provenance=mode=max --metadata-file=(tmp) . --push")
+}
+
+func TestDockerEngineRegistryLogin(t *testing.T) {
+	invocation := ""
+	stdin := ""
+
+	engine := &dockerEngine{runCLI: func(_ context.Context, input io.Reader, _ io.Writer, args ...string) error {
+		invocation = strings.Join(args, " ")
+		stdinBytes, err := io.ReadAll(input)
+		stdin = string(stdinBytes)
+		return err
+	}}
+
+	assert.Ok(t, engine.RegistryLogin(context.Background(), "ghcr.io", "joonas", "hunter2"))
+
+	// password not visible in process list
+	assert.Equal(t, invocation, "docker login --username joonas --password-stdin ghcr.io")
+	assert.Equal(t, stdin, "hunter2")
+}
+
+func newTestDockerEngine(t *testing.T, handler http.HandlerFunc) (*dockerEngine, func()) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+
+	return &dockerEngine{client: server.Client(), baseURL: server.URL}, server.Close
+}
+
+func TestDockerEngineBuildAndPushImageAttestationsIntegration(t *testing.T) {
+	skipUnlessIntegrationTest(t, "docker")
+
+	registry := startTestRegistry(t)
+
+	digest := pushTestImage(t, registry+"/bob-integration", true, "min")
+
+	index, indexDigest := getTestRegistryManifest(t, registry, "bob-integration", "test")
+	assert.Equal(t, indexDigest, digest)
+
+	// https://docs.docker.com/build/metadata/attestations/attestation-storage/
+	predicateTypes := []string{}
+	for _, manifest := range index.Manifests {
+		if manifest.Annotations["vnd.docker.reference.type"] != "attestation-manifest" {
+			continue
+		}
+
+		attestation, _ := getTestRegistryManifest(t, registry, "bob-integration", manifest.Digest)
+		for _, layer := range attestation.Layers {
+			predicateTypes = append(predicateTypes, layer.Annotations["in-toto.io/predicate-type"])
+		}
+	}
+	slices.Sort(predicateTypes)
+
+	// provenance's version depends on BuildKit version
+	assert.Matches(t, strings.Join(predicateTypes, ","), `^https://slsa\.dev/provenance/v[0-9.]+,https://spdx\.dev/Document$`)
+}
+
+// integration tests are opt-in, as they need Docker (with buildx) and network access for pulling
+// images (registry, BuildKit, SBOM scanner):
+//
+//	$ BOB_INTEGRATION_TESTS=true go test ./...
+func skipUnlessIntegrationTest(t *testing.T, tools ...string) {
+	t.Helper()
+
+	if os.Getenv("BOB_INTEGRATION_TESTS") == "" {
+		t.Skip("integration test (enable with BOB_INTEGRATION_TESTS=true)")
+	}
+
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("integration test needs %s: %v", tool, err)
+		}
+	}
+}
+
+// starts a registry:2 container and a buildx builder that can push to it (both removed when the test ends).
+// returns "localhost:<port>".
+func startTestRegistry(t *testing.T) string {
+	t.Helper()
+
+	name := "bob-integration-test-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	docker := func(args ...string) string {
+		t.Helper()
+
+		output := &bytes.Buffer{}
+		if err := execCLI(context.Background(), nil, output, append([]string{"docker"}, args...)...); err != nil {
+			t.Fatalf("docker %s: %v\n%s", strings.Join(args, " "), err, output.String())
+		}
+
+		return strings.TrimSpace(output.String())
+	}
+
+	t.Cleanup(func() {
+		_ = execCLI(context.Background(), nil, io.Discard, "docker", "rm", "--force", name)
+	})
+	docker("run", "--detach", "--name", name, "--publish", "127.0.0.1::5000", "registry:2")
+
+	// "127.0.0.1:32768"
+	_, port, err := net.SplitHostPort(docker("port", name, "5000/tcp"))
+	assert.Ok(t, err)
+
+	registry := "localhost:" + port
+
+	// default builder (docker driver) can't push attestations. host network so the builder reaches the registry.
+	buildkitdConfig := filepath.Join(t.TempDir(), "buildkitd.toml")
+	assert.Ok(t, os.WriteFile(buildkitdConfig, []byte(fmt.Sprintf("[registry.%q]\n  http = true\n", registry)), 0600))
+
+	t.Cleanup(func() {
+		_ = execCLI(context.Background(), nil, io.Discard, "docker", "buildx", "rm", name)
+	})
+	docker("buildx", "create", "--name", name, "--driver", "docker-container", "--driver-opt", "network=host", "--config", buildkitdConfig)
+
+	t.Setenv("BUILDX_BUILDER", name)
+
+	// registry takes a moment to start listening
+	for attempt := 1; ; attempt++ {
+		resp, err := http.Get("http://" + registry + "/v2/")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return registry
+			}
+		}
+
+		if attempt == 50 {
+			t.Fatalf("registry didn't start: %v", err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// builds and pushes a tiny image as "<repository>:test". returns its digest.
+func pushTestImage(t *testing.T, repository string, sbom bool, provenance string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	assert.Ok(t, os.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM scratch\nCOPY hello.txt /\n"), 0600))
+	assert.Ok(t, os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello\n"), 0600))
+
+	engine, err := newDockerEngineFromEnv()
+	assert.Ok(t, err)
+
+	output := &bytes.Buffer{}
+	digest, err := engine.BuildAndPushImage(context.Background(), imageBuildSpec{
+		DockerfilePath: filepath.Join(dir, "Dockerfile"),
+		ContextDir:     dir,
+		Tags:           []string{repository + ":test"},
+		SBOM:           sbom,
+		Provenance:     provenance,
+		Push:           true,
+	}, output)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, output.String())
+	}
+
+	return digest
+}
+
+// image index or image manifest
+type testRegistryManifest struct {
+	Manifests []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"manifests"`
+	Layers []struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// reference is tag or digest. returns also the manifest's digest.
+func getTestRegistryManifest(t *testing.T, registry string, repository string, reference string) (*testRegistryManifest, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+registry+"/v2/"+repository+"/manifests/"+reference, nil)
+	assert.Ok(t, err)
+	req.Header.Set("Accept", strings.Join([]string{
+		"application/vnd.oci.image.index.v1+json",
+		"application/vnd.oci.image.manifest.v1+json",
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+		"application/vnd.docker.distribution.manifest.v2+json",
+	}, ", "))
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.Ok(t, err)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("manifest %s:%s: %s", repository, reference, resp.Status)
+	}
+
+	manifest := &testRegistryManifest{}
+	assert.Ok(t, json.NewDecoder(resp.Body).Decode(manifest))
+
+	return manifest, resp.Header.Get("Docker-Content-Digest")
+}
@@ -0,0 +1,342 @@
+package main
+
+// Publishes collected artefacts (+ their checksums) to a GitHub Release of the revision being built,
+// so builder images don't each need to implement their own uploading.
+//
+// Re-runs are idempotent: an existing release is reused and assets that already exist are not
+// re-uploaded, if their digest matches the one in the release's checksums file. (size alone can't
+// tell a rebuilt asset from the previously uploaded one.)
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/function61/gokit/net/http/ezhttp"
+	"github.com/function61/turbobob/pkg/typeddigest"
+)
+
+type githubRelease struct {
+	ID        int64                `json:"id"`
+	HTMLURL   string               `json:"html_url"`
+	UploadURL string               `json:"upload_url"` // URI template, like "https://uploads.github.com/repos/o/r/releases/1/assets{?name,label}"
+	Assets    []githubReleaseAsset `json:"assets"`
+}
+
+type githubReleaseAsset struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// file to upload as a release asset
+type githubReleaseAssetFile struct {
+	name      string // name of the asset in the release
+	path      string // local path
+	hexDigest string // as in checksums file. empty for the checksums file itself
+}
+
+// https://docs.github.com/en/rest/releases
+type githubReleasesClient struct {
+	apiBaseURL string // "https://api.github.com", no trailing slash
+	repository string // "function61/turbobob"
+	token      string
+}
+
+// *repository* can be empty, in which case it's taken from ENV (GitHub Actions sets it).
+// API base URL can be overridden with $GITHUB_API_URL (GitHub Enterprise Server or a local stand-in for testing).
+func newGithubReleasesClientFromEnv(repository string) (*githubReleasesClient, error) {
+	repository = firstNonEmpty(repository, os.Getenv("GITHUB_REPOSITORY"))
+	if repository == "" {
+		return nil, errors.New("repository not specified and GITHUB_REPOSITORY not set")
+	}
+
+	token := os.Getenv("GITHUB_TOKEN")
+	if token == "" {
+		return nil, errors.New("GITHUB_TOKEN not set")
+	}
+
+	return &githubReleasesClient{
+		apiBaseURL: strings.TrimSuffix(firstNonEmpty(os.Getenv("GITHUB_API_URL"), "https://api.github.com"), "/"),
+		repository: repository,
+		token:      token,
+	}, nil
+}
+
+// returns existing release for the tag, or creates one
+func (g *githubReleasesClient) ensureRelease(ctx context.Context, tag string, commitish string, prerelease bool) (*githubRelease, error) {
+	withErr := func(err error) (*githubRelease, error) { return nil, fmt.Errorf("ensureRelease: %w", err) }
+
+	release := &githubRelease{}
+	_, err := ezhttp.Get(
+		ctx,
+		g.apiBaseURL+"/repos/"+g.repository+"/releases/tags/"+url.PathEscape(tag),
+		g.auth(),
+		ezhttp.RespondsJSONAllowUnknownFields(release))
+	switch {
+	case err == nil:
+		return release, nil
+	case !ezhttp.ErrorIs(err, http.StatusNotFound):
+		return withErr(err)
+	}
+
+	if _, err := ezhttp.Post(
+		ctx,
+		g.apiBaseURL+"/repos/"+g.repository+"/releases",
+		g.auth(),
+		ezhttp.SendJSON(struct {
+			TagName         string `json:"tag_name"`
+			TargetCommitish string `json:"target_commitish"`
+			Name            string `json:"name"`
+			Prerelease      bool   `json:"prerelease"`
+		}{
+			TagName:         tag,
+			TargetCommitish: commitish,
+			Name:            tag,
+			Prerelease:      prerelease,
+		}),
+		ezhttp.RespondsJSONAllowUnknownFields(release),
+	); err != nil {
+		return withErr(err)
+	}
+
+	return release, nil
+}
+
+func (g *githubReleasesClient) uploadAsset(ctx context.Context, release *githubRelease, file githubReleaseAssetFile) error {
+	withErr := func(err error) error { return fmt.Errorf("uploadAsset: %s: %w", file.name, err) }
+
+	content, err := os.Open(file.path)
+	if err != nil {
+		return withErr(err)
+	}
+	defer content.Close()
+
+	info, err := content.Stat()
+	if err != nil {
+		return withErr(err)
+	}
+
+	// "https://uploads.github.com/repos/o/r/releases/1/assets{?name,label}" => "https://uploads.github.com/repos/o/r/releases/1/assets"
+	uploadURL, _, _ := strings.Cut(release.UploadURL, "{")
+
+	res, err := ezhttp.Post(
+		ctx,
+		uploadURL+"?name="+url.QueryEscape(file.name),
+		g.auth(),
+		ezhttp.SendBody(content, "application/octet-stream"),
+		ezhttp.After(func(conf *ezhttp.Config) {
+			conf.Request.ContentLength = info.Size() // uploads API doesn't accept chunked transfer
+		}))
+	if err != nil {
+		return withErr(err)
+	}
+
+	return res.Body.Close()
+}
+
+func (g *githubReleasesClient) downloadAsset(ctx context.Context, asset githubReleaseAsset) ([]byte, error) {
+	withErr := func(err error) ([]byte, error) { return nil, fmt.Errorf("downloadAsset: %s: %w", asset.Name, err) }
+
+	res, err := ezhttp.Get(
+		ctx,
+		fmt.Sprintf("%s/repos/%s/releases/assets/%d", g.apiBaseURL, g.repository, asset.ID),
+		g.auth(),
+		ezhttp.Header("Accept", "application/octet-stream")) // instead of asset's metadata
+	if err != nil {
+		return withErr(err)
+	}
+	defer res.Body.Close()
+
+	content, err := io.ReadAll(res.Body)
+	if err != nil {
+		return withErr(err)
+	}
+
+	return content, nil
+}
+
+func (g *githubReleasesClient) deleteAsset(ctx context.Context, asset githubReleaseAsset) error {
+	res, err := ezhttp.Del(
+		ctx,
+		fmt.Sprintf("%s/repos/%s/releases/assets/%d", g.apiBaseURL, g.repository, asset.ID),
+		g.auth())
+	if err != nil {
+		return fmt.Errorf("deleteAsset: %s: %w", asset.Name, err)
+	}
+
+	return res.Body.Close()
+}
+
+func (g *githubReleasesClient) auth() ezhttp.ConfigPiece {
+	return ezhttp.AuthBearer(g.token)
+}
+
+// creates (if needed) release for *tag* and uploads files to it. returns URL of the release.
+func publishToGithubRelease(
+	ctx context.Context,
+	client *githubReleasesClient,
+	tag string,
+	commitish string,
+	prerelease bool,
+	files []githubReleaseAssetFile,
+) (string, error) {
+	withErr := func(err error) (string, error) { return "", fmt.Errorf("publishToGithubRelease: %w", err) }
+
+	release, err := client.ensureRelease(ctx, tag, commitish, prerelease)
+	if err != nil {
+		return withErr(err)
+	}
+
+	existingAssets := map[string]githubReleaseAsset{}
+	for _, asset := range release.Assets {
+		existingAssets[asset.Name] = asset
+	}
+
+	// checksums published by a previous run. (the checksums file is uploaded last, so it doesn't
+	// vouch for assets a previous run didn't get to upload.)
+	publishedSums := []byte{}
+	if sumsAsset, exists := existingAssets[artefactsManifestSumsName]; exists {
+		publishedSums, err = client.downloadAsset(ctx, sumsAsset)
+		if err != nil {
+			return withErr(err)
+		}
+	}
+	publishedHexDigests := parseSha256SumsByAssetName(string(publishedSums))
+
+	alreadyUploaded := func(file githubReleaseAssetFile, existing githubReleaseAsset) (bool, error) {
+		if file.name == artefactsManifestSumsName {
+			content, err := os.ReadFile(file.path)
+			return bytes.Equal(content, publishedSums), err
+		}
+
+		info, err := os.Stat(file.path)
+		if err != nil {
+			return false, err
+		}
+
+		return existing.Size == info.Size() && file.hexDigest != "" && publishedHexDigests[file.name] == file.hexDigest, nil
+	}
+
+	// checksums file goes last, so it only vouches for assets that got uploaded
+	pending := []githubReleaseAssetFile{}
+	var sumsFile *githubReleaseAssetFile
+	for _, file := range files {
+		if file.name == artefactsManifestSumsName {
+			sumsFile = &file
+			continue
+		}
+
+		if existing, exists := existingAssets[file.name]; exists {
+			uploaded, err := alreadyUploaded(file, existing)
+			if err != nil {
+				return withErr(err)
+			}
+
+			if uploaded {
+				fmt.Printf("%s (already uploaded)\n", file.name)
+				continue
+			}
+		}
+
+		pending = append(pending, file)
+	}
+
+	if sumsFile != nil {
+		sumsUploaded := false
+		if existing, exists := existingAssets[sumsFile.name]; exists && len(pending) == 0 {
+			sumsUploaded, err = alreadyUploaded(*sumsFile, existing)
+			if err != nil {
+				return withErr(err)
+			}
+		}
+
+		if sumsUploaded {
+			fmt.Printf("%s (already uploaded)\n", sumsFile.name)
+		} else {
+			pending = append(pending, *sumsFile)
+		}
+	}
+
+	// old checksums must not outlive the assets they vouch for. otherwise a run interrupted after
+	// replacing an asset would leave checksums by which a later run would skip uploading stale bytes.
+	if sumsAsset, exists := existingAssets[artefactsManifestSumsName]; exists && len(pending) > 0 {
+		if err := client.deleteAsset(ctx, sumsAsset); err != nil {
+			return withErr(err)
+		}
+		delete(existingAssets, artefactsManifestSumsName)
+	}
+
+	for _, file := range pending {
+		// rebuilt, or a previous run got interrupted while uploading
+		if existing, exists := existingAssets[file.name]; exists {
+			if err := client.deleteAsset(ctx, existing); err != nil {
+				return withErr(err)
+			}
+		}
+
+		fmt.Printf("%s\n", file.name)
+
+		if err := client.uploadAsset(ctx, release, file); err != nil {
+			return withErr(err)
+		}
+	}
+
+	return release.HTMLURL, nil
+}
+
+// assets are named by artefacts' basenames (releases have no directories), plus the checksums file.
+// *rootDir* is the directory artefact paths are relative to.
+func githubReleaseAssetFiles(rootDir string, artefacts []Artefact, manifestDir string) ([]githubReleaseAssetFile, error) {
+	files := []githubReleaseAssetFile{}
+	pathByName := map[string]string{}
+
+	for _, artefact := range artefacts {
+		name := path.Base(artefact.Path)
+
+		digest, err := typeddigest.Parse(artefact.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", artefact.Path, err)
+		}
+
+		if otherPath, taken := pathByName[name]; taken {
+			return nil, fmt.Errorf("artefacts %s and %s would have the same release asset name %s", otherPath, artefact.Path, name)
+		}
+		pathByName[name] = artefact.Path
+
+		files = append(files, githubReleaseAssetFile{
+			name:      name,
+			path:      filepath.Join(rootDir, filepath.FromSlash(artefact.Path)),
+			hexDigest: digest.HexDigest(),
+		})
+	}
+
+	if _, taken := pathByName[artefactsManifestSumsName]; taken {
+		return nil, fmt.Errorf("artefact name conflicts with checksums file: %s", artefactsManifestSumsName)
+	}
+
+	return append(files, githubReleaseAssetFile{
+		name: artefactsManifestSumsName,
+		path: filepath.Join(manifestDir, artefactsManifestSumsName),
+	}), nil
+}
+
+// "<hex digest>  rel/bob_linux-amd64" lines => "bob_linux-amd64" => "<hex digest>"
+func parseSha256SumsByAssetName(sums string) map[string]string {
+	hexDigests := map[string]string{}
+	for _, line := range strings.Split(sums, "\n") {
+		if hexDigest, artefactPath, ok := strings.Cut(line, "  "); ok {
+			hexDigests[path.Base(artefactPath)] = hexDigest
+		}
+	}
+
+	return hexDigests
+}
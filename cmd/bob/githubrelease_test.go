@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/typeddigest"
+)
+
+func TestPublishToGithubRelease(t *testing.T) {
+	fakeGithub := newFakeGithubReleases()
+	server := httptest.NewServer(fakeGithub)
+	defer server.Close()
+	fakeGithub.baseURL = server.URL
+
+	client := &githubReleasesClient{apiBaseURL: server.URL, repository: "function61/turbobob", token: "dummy"}
+
+	rootDir := t.TempDir()
+	manifestDir := t.TempDir()
+
+	assert.Ok(t, os.MkdirAll(filepath.Join(rootDir, "rel"), 0755))
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel/bob_linux-amd64"), []byte("amd64 binary"), 0644))
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel/bob_linux-arm64"), []byte("arm64 binary"), 0644))
+
+	var files []githubReleaseAssetFile
+
+	// like a build does
+	collect := func() {
+		t.Helper()
+
+		artefacts := []Artefact{}
+		for _, artefactPath := range []string{"rel/bob_linux-amd64", "rel/bob_linux-arm64"} {
+			digest, err := digestFile(filepath.Join(rootDir, artefactPath), typeddigest.Sha256)
+			assert.Ok(t, err)
+
+			artefacts = append(artefacts, Artefact{Path: artefactPath, Digest: digest.String()})
+		}
+
+		sums, err := artefactsAsSha256Sums(artefacts)
+		assert.Ok(t, err)
+		assert.Ok(t, os.WriteFile(filepath.Join(manifestDir, artefactsManifestSumsName), []byte(sums), 0644))
+
+		files, err = githubReleaseAssetFiles(rootDir, artefacts, manifestDir)
+		assert.Ok(t, err)
+	}
+
+	collect()
+
+	publish := func() string {
+		releaseURL, err := publishToGithubRelease(context.Background(), client, "20200219_1609_9c39d027", "9c39d0271d0bd51c7ddfb55dc3051e68b6953c33", false, files)
+		assert.Ok(t, err)
+		return releaseURL
+	}
+
+	assert.Equal(t, publish(), "https://github.com/function61/turbobob/releases/tag/20200219_1609_9c39d027")
+	assert.Equal(t, fakeGithub.log(), `POST /releases tag=20200219_1609_9c39d027 commitish=9c39d0271d0bd51c7ddfb55dc3051e68b6953c33
+POST /assets bob_linux-amd64 (12 bytes)
+POST /assets bob_linux-arm64 (12 bytes)
+POST /assets SHA256SUMS (172 bytes)`)
+
+	// re-run is idempotent
+	assert.Equal(t, publish(), "https://github.com/function61/turbobob/releases/tag/20200219_1609_9c39d027")
+	assert.Equal(t, fakeGithub.log(), "")
+
+	// rebuilt asset gets replaced, even if its size didn't change
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel/bob_linux-arm64"), []byte("ARM64 binary"), 0644))
+	collect()
+
+	publish()
+	assert.Equal(t, fakeGithub.log(), `DELETE /assets SHA256SUMS
+DELETE /assets bob_linux-arm64
+POST /assets bob_linux-arm64 (12 bytes)
+POST /assets SHA256SUMS (172 bytes)`)
+
+	// interrupted upload (size differs) gets replaced, even if checksums file vouches for it
+	fakeGithub.truncateAsset("bob_linux-amd64")
+
+	publish()
+	assert.Equal(t, fakeGithub.log(), `DELETE /assets SHA256SUMS
+DELETE /assets bob_linux-amd64
+POST /assets bob_linux-amd64 (12 bytes)
+POST /assets SHA256SUMS (172 bytes)`)
+
+	// run interrupted after replacing an asset (before uploading the checksums file) ..
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel/bob_linux-arm64"), []byte("arm64 binary"), 0644))
+	collect()
+
+	_, err := publishToGithubRelease(context.Background(), client, "20200219_1609_9c39d027", "9c39d0271d0bd51c7ddfb55dc3051e68b6953c33", false, files[:len(files)-1])
+	assert.Ok(t, err)
+	assert.Equal(t, fakeGithub.log(), `DELETE /assets SHA256SUMS
+DELETE /assets bob_linux-arm64
+POST /assets bob_linux-arm64 (12 bytes)`)
+
+	// .. and a later run with the previous bytes can't trust stale checksums, as there are none
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, "rel/bob_linux-arm64"), []byte("ARM64 binary"), 0644))
+	collect()
+
+	publish()
+	assert.Equal(t, fakeGithub.log(), `DELETE /assets bob_linux-amd64
+POST /assets bob_linux-amd64 (12 bytes)
+DELETE /assets bob_linux-arm64
+POST /assets bob_linux-arm64 (12 bytes)
+POST /assets SHA256SUMS (172 bytes)`)
+}
+
+func TestGithubReleaseAssetFilesNameConflict(t *testing.T) {
+	_, err := githubReleaseAssetFiles("/project", []Artefact{
+		{Path: "rel/linux/bob", Digest: "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592"},
+		{Path: "rel/darwin/bob", Digest: "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592"},
+	}, "/tmp/bob/turbobob/artefacts")
+	assert.Equal(t, err.Error(), "artefacts rel/linux/bob and rel/darwin/bob would have the same release asset name bob")
+}
+
+// in-memory stand-in for GitHub's releases API. supports one release.
+type fakeGithubReleases struct {
+	baseURL  string
+	release  *githubRelease
+	contents map[int64][]byte // asset ID => content
+	nextID   int64
+	mutating []string // log of mutating calls since last call to log()
+	mu       sync.Mutex
+}
+
+func newFakeGithubReleases() *fakeGithubReleases {
+	return &fakeGithubReleases{nextID: 1, contents: map[int64][]byte{}}
+}
+
+func (f *fakeGithubReleases) truncateAsset(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for idx, asset := range f.release.Assets {
+		if asset.Name == name {
+			f.release.Assets[idx].Size = asset.Size / 2
+			f.contents[asset.ID] = f.contents[asset.ID][:asset.Size/2]
+		}
+	}
+}
+
+func (f *fakeGithubReleases) log() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	defer func() { f.mutating = nil }()
+	return strings.Join(f.mutating, "\n")
+}
+
+func (f *fakeGithubReleases) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer dummy" {
+		http.Error(w, "bad credentials", http.StatusUnauthorized)
+		return
+	}
+
+	respondJSON := func(status int, body any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+
+	const repoPrefix = "/repos/function61/turbobob/releases"
+
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, repoPrefix+"/tags/"):
+		if f.release == nil {
+			http.Error(w, `{"message": "Not Found"}`, http.StatusNotFound)
+			return
+		}
+
+		respondJSON(http.StatusOK, f.release)
+	case r.Method == http.MethodPost && r.URL.Path == repoPrefix:
+		req := struct {
+			TagName         string `json:"tag_name"`
+			TargetCommitish string `json:"target_commitish"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f.mutating = append(f.mutating, fmt.Sprintf("POST /releases tag=%s commitish=%s", req.TagName, req.TargetCommitish))
+
+		f.release = &githubRelease{
+			ID:        f.newID(),
+			HTMLURL:   "https://github.com/function61/turbobob/releases/tag/" + req.TagName,
+			UploadURL: f.baseURL + "/uploads/assets{?name,label}",
+			Assets:    []githubReleaseAsset{},
+		}
+
+		respondJSON(http.StatusCreated, f.release)
+	case r.Method == http.MethodPost && r.URL.Path == "/uploads/assets":
+		if r.ContentLength < 0 {
+			http.Error(w, "Content-Length required", http.StatusLengthRequired)
+			return
+		}
+
+		content, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+
+		for _, asset := range f.release.Assets {
+			if asset.Name == name {
+				http.Error(w, `{"message": "already_exists"}`, http.StatusUnprocessableEntity)
+				return
+			}
+		}
+
+		f.mutating = append(f.mutating, fmt.Sprintf("POST /assets %s (%d bytes)", name, len(content)))
+
+		asset := githubReleaseAsset{ID: f.newID(), Name: name, Size: int64(len(content))}
+		f.release.Assets = append(f.release.Assets, asset)
+		f.contents[asset.ID] = content
+
+		respondJSON(http.StatusCreated, asset)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, repoPrefix+"/assets/"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, repoPrefix+"/assets/"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		content, found := f.contents[id]
+		if !found || r.Header.Get("Accept") != "application/octet-stream" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write(content)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, repoPrefix+"/assets/"):
+		id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, repoPrefix+"/assets/"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		for idx, asset := range f.release.Assets {
+			if asset.ID == id {
+				f.mutating = append(f.mutating, "DELETE /assets "+asset.Name)
+				f.release.Assets = append(f.release.Assets[:idx], f.release.Assets[idx+1:]...)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		http.NotFound(w, r)
+	default:
+		http.Error(w, "unsupported: "+r.Method+" "+r.URL.Path, http.StatusNotImplemented)
+	}
+}
+
+func (f *fakeGithubReleases) newID() int64 {
+	defer func() { f.nextID++ }()
+	return f.nextID
+}
@@ -0,0 +1,34 @@
+package main
+
+// Image signing with cosign (https://github.com/sigstore/cosign). like with buildx, we shell out to
+// the tool instead of linking its (large) libraries.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// signs the image by digest, so the signature covers exactly what we pushed. returns signature's ref.
+// key is anything `$ cosign sign --key` accepts (file, "env://...", KMS URI). COSIGN_PASSWORD etc. are honored.
+func signImage(ctx context.Context, runCLI cliRunner, repository string, digest string, key string, output io.Writer) (string, error) {
+	withErr := func(err error) (string, error) { return "", fmt.Errorf("signImage: %w", err) }
+
+	if digest == "" {
+		return withErr(errors.New("no digest for image " + repository))
+	}
+
+	if err := runCLI(ctx, nil, output, "cosign", "sign", "--yes", "--key", key, repository+"@"+digest); err != nil {
+		return withErr(err)
+	}
+
+	return cosignSignatureRef(repository, digest), nil
+}
+
+// cosign stores the signature as a tag in the image's repository:
+// ("fn61/turbobob", "sha256:abc...") => "fn61/turbobob:sha256-abc....sig"
+func cosignSignatureRef(repository string, digest string) string {
+	return repository + ":" + strings.Replace(digest, ":", "-", 1) + ".sig"
+}
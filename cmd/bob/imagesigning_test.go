@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestSignImage(t *testing.T) {
+	invocation := ""
+
+	signature, err := signImage(context.Background(), func(_ context.Context, _ io.Reader, _ io.Writer, args ...string) error {
+		invocation = strings.Join(args, " ")
+		return nil
+	}, "ghcr.io/function61/turbobob", "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592", "env://COSIGN_PRIVATE_KEY", io.Discard)
+	assert.Ok(t, err)
+
+	assert.Equal(t, invocation, "cosign sign --yes --key env://COSIGN_PRIVATE_KEY ghcr.io/function61/turbobob@sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592")
+	assert.Equal(t, signature, "ghcr.io/function61/turbobob:sha256-d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592.sig")
+
+	_, err = signImage(context.Background(), execCLI, "ghcr.io/function61/turbobob", "", "cosign.key", io.Discard)
+	assert.Equal(t, err.Error(), "signImage: no digest for image ghcr.io/function61/turbobob")
+}
+
+func TestSignImageIntegration(t *testing.T) {
+	skipUnlessIntegrationTest(t, "docker", "cosign")
+
+	registry := startTestRegistry(t)
+	repository := registry + "/bob-integration"
+
+	digest := pushTestImage(t, repository, false, "")
+
+	keyDir := t.TempDir()
+	t.Setenv("COSIGN_PASSWORD", "")
+
+	output := &bytes.Buffer{}
+	cosign := func(args ...string) {
+		t.Helper()
+
+		if err := execCLI(context.Background(), nil, output, append([]string{"cosign"}, args...)...); err != nil {
+			t.Fatalf("cosign %s: %v\n%s", strings.Join(args, " "), err, output.String())
+		}
+	}
+
+	cosign("generate-key-pair", "--output-key-prefix="+filepath.Join(keyDir, "cosign"))
+
+	// don't publish test signatures to the public transparency log
+	withoutTlog := func(ctx context.Context, stdin io.Reader, output io.Writer, args ...string) error {
+		return execCLI(ctx, stdin, output, append([]string{args[0], args[1], "--tlog-upload=false"}, args[2:]...)...)
+	}
+
+	signature, err := signImage(context.Background(), withoutTlog, repository, digest, filepath.Join(keyDir, "cosign.key"), output)
+	if err != nil {
+		t.Fatalf("%v\n%s", err, output.String())
+	}
+	assert.Equal(t, signature, cosignSignatureRef(repository, digest))
+
+	// the signature is where we reported it to be
+	getTestRegistryManifest(t, registry, "bob-integration", strings.TrimPrefix(signature, repository+":"))
+
+	cosign("verify", "--key", filepath.Join(keyDir, "cosign.pub"), "--insecure-ignore-tlog=true", repository+"@"+digest)
+}
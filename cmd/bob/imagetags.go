@@ -0,0 +1,195 @@
+package main
+
+// Image tag templates, like "{{.Branch}}" or "{{.Major}}.{{.Minor}}". a release tagged "v1.4.2" in
+// version control can automatically produce image tags "1.4.2", "1.4" and "1".
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/versioncontrol"
+	"github.com/samber/lo"
+)
+
+// https://github.com/distribution/reference/blob/main/reference.go
+var dockerTagRe = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+
+type semverTag struct {
+	tag        string // as in version control, like "v1.4.2"
+	major      int
+	minor      int
+	patch      int
+	prerelease string // "rc.1" for "1.5.0-rc.1"
+}
+
+// "1.4.2" for "v1.4.2"
+func (s semverTag) Version() string {
+	version := fmt.Sprintf("%d.%d.%d", s.major, s.minor, s.patch)
+	if s.prerelease != "" {
+		version += "-" + s.prerelease
+	}
+
+	return version
+}
+
+var semverTagRe = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// nil if not a semver tag
+func parseSemverTag(tag string) *semverTag {
+	match := semverTagRe.FindStringSubmatch(tag)
+	if match == nil {
+		return nil
+	}
+
+	// regexp guarantees digits
+	number := func(digits string) int {
+		n, _ := strconv.Atoi(digits)
+		return n
+	}
+
+	return &semverTag{
+		tag:        tag,
+		major:      number(match[1]),
+		minor:      number(match[2]),
+		patch:      number(match[3]),
+		prerelease: match[4],
+	}
+}
+
+// highest semver of *tags*. nil if none of them are semver.
+func highestSemverTag(tags []string) *semverTag {
+	var highest *semverTag
+	for _, tag := range tags {
+		semver := parseSemverTag(tag)
+		if semver == nil {
+			continue
+		}
+
+		if highest == nil || semverLess(*highest, *semver) {
+			highest = semver
+		}
+	}
+
+	return highest
+}
+
+// the most release-like of revision's tags: highest semver, or the first one if none are semver. empty if no tags.
+func revisionTag(tags []string) string {
+	if semver := highestSemverTag(tags); semver != nil {
+		return semver.tag
+	}
+
+	if len(tags) > 0 {
+		return tags[0]
+	}
+
+	return ""
+}
+
+// prereleases are ordered only relative to release (= lower), not among themselves
+func semverLess(a, b semverTag) bool {
+	if a.major != b.major {
+		return a.major < b.major
+	}
+	if a.minor != b.minor {
+		return a.minor < b.minor
+	}
+	if a.patch != b.patch {
+		return a.patch < b.patch
+	}
+
+	return a.prerelease != "" && b.prerelease == ""
+}
+
+// values available to tag templates. values that aren't available (e.g. no semver tag at the
+// revision) are left out, so templates referring to them produce no tag.
+func imageTagTemplateData(revisionID *versioncontrol.RevisionID) map[string]string {
+	data := map[string]string{
+		"FriendlyRevisionID": revisionID.FriendlyRevisionID,
+		"RevisionID":         revisionID.RevisionID,
+		"RevisionIDShort":    revisionID.RevisionIDShort,
+	}
+
+	if revisionID.Branch != "" {
+		data["Branch"] = sanitizeDockerTag(revisionID.Branch)
+	}
+
+	if tag := revisionTag(revisionID.Tags); tag != "" {
+		data["Tag"] = sanitizeDockerTag(tag)
+	}
+
+	if semver := highestSemverTag(revisionID.Tags); semver != nil {
+		data["SemverFromTag"] = semver.Version()
+
+		// "1.5.0-rc.1" must not move the "1.5" or "1" tags
+		if semver.prerelease == "" {
+			data["Major"] = strconv.Itoa(semver.major)
+			data["Minor"] = strconv.Itoa(semver.minor)
+			data["Patch"] = strconv.Itoa(semver.patch)
+		}
+	}
+
+	return data
+}
+
+// evaluates tag templates. templates referring to unavailable values are skipped. result is deduplicated.
+func expandImageTagTemplates(templates []string, data map[string]string) ([]string, error) {
+	tags := []string{}
+	for _, tagTemplate := range templates {
+		tmpl, err := template.New("").Option("missingkey=error").Parse(tagTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("tag template %s: %w", tagTemplate, err)
+		}
+
+		tag := &strings.Builder{}
+		if err := tmpl.Execute(tag, data); err != nil {
+			// works when the unavailable values are present => only refers to values not available for this build
+			if tmpl.Execute(io.Discard, withAllImageTagTemplateKeys(data)) == nil {
+				continue
+			}
+
+			return nil, fmt.Errorf("tag template %s: %w", tagTemplate, err)
+		}
+
+		if !dockerTagRe.MatchString(tag.String()) {
+			return nil, fmt.Errorf("tag template %s: invalid tag: '%s'", tagTemplate, tag.String())
+		}
+
+		if !lo.Contains(tags, tag.String()) {
+			tags = append(tags, tag.String())
+		}
+	}
+
+	return tags, nil
+}
+
+// *data* with the values not available for this build filled with placeholders
+func withAllImageTagTemplateKeys(data map[string]string) map[string]string {
+	all := map[string]string{}
+	for _, key := range bobfile.DockerImageTagTemplateKeys {
+		all[key] = "x"
+	}
+
+	for key, value := range data {
+		all[key] = value
+	}
+
+	return all
+}
+
+var dockerTagDisallowedCharsRe = regexp.MustCompile(`[^\w.-]+`)
+
+// "feature/login" => "feature-login"
+func sanitizeDockerTag(input string) string {
+	sanitized := strings.TrimLeft(dockerTagDisallowedCharsRe.ReplaceAllString(input, "-"), ".-")
+	if len(sanitized) > 128 {
+		sanitized = sanitized[:128]
+	}
+
+	return sanitized
+}
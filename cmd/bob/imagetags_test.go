@@ -0,0 +1,84 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/versioncontrol"
+	"github.com/samber/lo"
+)
+
+func TestExpandImageTagTemplates(t *testing.T) {
+	templates := []string{"{{.SemverFromTag}}", "{{.Major}}.{{.Minor}}", "{{.Major}}", "{{.Branch}}", "sha-{{.RevisionIDShort}}"}
+
+	for _, tc := range []struct {
+		name     string
+		branch   string
+		vcsTags  []string
+		expected string
+	}{
+		{"release", "main", []string{"v1.4.2"}, "1.4.2 1.4 1 main sha-2c9cd41a"},
+		{"highest semver wins", "main", []string{"v1.4.2", "v1.10.0", "deployed-to-prod"}, "1.10.0 1.10 1 main sha-2c9cd41a"},
+		{"prerelease doesn't move major/minor", "main", []string{"v1.5.0-rc.1"}, "1.5.0-rc.1 main sha-2c9cd41a"},
+		{"no tags", "feature/login", nil, "feature-login sha-2c9cd41a"},
+		{"detached, non-semver tag", "", []string{"nightly"}, "sha-2c9cd41a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tags, err := expandImageTagTemplates(templates, imageTagTemplateData(&versioncontrol.RevisionID{
+				RevisionID:         "2c9cd41a0c1d6f7bd1f52e3b7ba7ea4b0db4cc2c",
+				RevisionIDShort:    "2c9cd41a",
+				FriendlyRevisionID: "20250718_1205_2c9cd41a",
+				Branch:             tc.branch,
+				Tags:               tc.vcsTags,
+			}))
+			assert.Ok(t, err)
+
+			assert.Equal(t, strings.Join(tags, " "), tc.expected)
+		})
+	}
+}
+
+func TestExpandImageTagTemplatesInvalidTag(t *testing.T) {
+	_, err := expandImageTagTemplates([]string{"release {{.FriendlyRevisionID}}"}, imageTagTemplateData(&versioncontrol.RevisionID{FriendlyRevisionID: "20250718_1205_2c9cd41a"}))
+	assert.Equal(t, err.Error(), "tag template release {{.FriendlyRevisionID}}: invalid tag: 'release 20250718_1205_2c9cd41a'")
+}
+
+func TestExpandImageTagTemplatesUnknownKey(t *testing.T) {
+	_, err := expandImageTagTemplates([]string{"{{.Version}}"}, imageTagTemplateData(&versioncontrol.RevisionID{FriendlyRevisionID: "20250718_1205_2c9cd41a"}))
+	assert.Equal(t, err.Error(), `tag template {{.Version}}: template: :1:2: executing "" at <.Version>: map has no entry for key "Version"`)
+}
+
+func TestImageTagTemplateDataHasAllKeys(t *testing.T) {
+	data := imageTagTemplateData(&versioncontrol.RevisionID{
+		RevisionID:         "2c9cd41a0c1d6f7bd1f52e3b7ba7ea4b0db4cc2c",
+		RevisionIDShort:    "2c9cd41a",
+		FriendlyRevisionID: "20250718_1205_2c9cd41a",
+		Branch:             "main",
+		Tags:               []string{"v1.4.2"},
+	})
+
+	keys := lo.Keys(data)
+	slices.Sort(keys)
+	// Bobfile validation accepts exactly these
+	expected := slices.Clone(bobfile.DockerImageTagTemplateKeys)
+	slices.Sort(expected)
+
+	assert.Equal(t, strings.Join(keys, ","), strings.Join(expected, ","))
+}
+
+func TestBuilderContainerEnvsBranchAndTag(t *testing.T) {
+	envs, err := builderContainerEnvs(&versioncontrol.RevisionID{
+		RevisionID:         "2c9cd41a0c1d6f7bd1f52e3b7ba7ea4b0db4cc2c",
+		RevisionIDShort:    "2c9cd41a",
+		FriendlyRevisionID: "20250718_1205_2c9cd41a",
+		Branch:             "main",
+		Tags:               []string{"deployed-to-prod", "v1.4.2"},
+	}, bobfile.BuilderSpec{}, true, bobfile.OsArchesSpec{}, false, false)
+	assert.Ok(t, err)
+
+	// CI system's ENVs (if tests run in CI) are relayed after these
+	assert.Equal(t, strings.Join(envs[:5], " "), "FRIENDLY_REV_ID=20250718_1205_2c9cd41a REV_ID=2c9cd41a0c1d6f7bd1f52e3b7ba7ea4b0db4cc2c REV_ID_SHORT=2c9cd41a BRANCH=main TAG=v1.4.2")
+}
@@ -45,6 +45,10 @@ func info() error {
 		builderTable.AddRow("Dev command", strings.Join(builder.Commands.Dev, " "))
 		builderTable.AddRow("Dev ports", ports)
 
+		if len(builder.DependsOn) > 0 {
+			builderTable.AddRow("Depends on", strings.Join(builder.DependsOn, ", "))
+		}
+
 		for _, envKey := range builder.PassEnvs {
 			builderTable.AddRow(fmt.Sprintf("ENV(%s)", envKey), checkMarkSetNotSet.String(isEnvVarPresent(envKey)))
 		}
@@ -34,8 +34,6 @@ jobs:
 }
 
 func writeGitLabBoilerplate() error {
-	fmt.Fprintln(os.Stderr, "WARN: in-ci-autodetect-settings not updated to support GitLab")
-
 	return writeBoilerplate(".gitlab-ci.yml", `# Minimal Gitlab CI conf for Turbo Bob handoff
 # For help with problems: https://github.com/function61/turbobob/blob/master/docs/ci_gitlab.md
 
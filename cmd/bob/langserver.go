@@ -54,7 +54,7 @@ func langserverRunShim(ctx context.Context, langCodeRequested string) error {
 	langserverCmd, builder, err := func() ([]string, *bobfile.BuilderSpec, error) {
 		for _, builder := range projectFile.Builders {
 			// FIXME: this assumes all builders have a config file defined
-			baseImageConf, err := loadNonOptionalBaseImageConf(projectFile.ProjectName, builder)
+			baseImageConf, err := loadNonOptionalBaseImageConf(ctx, projectFile.ProjectName, builder)
 			if err != nil {
 				return nil, nil, fmt.Errorf("loadNonOptionalBaseImageConf: %w", err)
 			}
@@ -78,12 +78,22 @@ func langserverRunShim(ctx context.Context, langCodeRequested string) error {
 	// to compiler cache, built object files etc.
 	containerName := devContainerName(projectFile, *builder)
 
-	if !isDevContainerRunning(containerName) {
+	devContainerRunning, err := isDevContainerRunning(ctx, containerName)
+	if err != nil {
+		return err
+	}
+
+	if !devContainerRunning {
 		return fmt.Errorf("container '%s' is not running. did you forget to run `$ bob dev` first?", containerName)
 	}
 
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return err
+	}
+
 	// not using "--tty" because with it we got "gopls: the input device is not a TTY"
-	dockerized := append([]string{"docker", "exec", "--interactive", containerName}, langserverCmd...)
+	dockerized := append([]string{containerRuntime.CLI(), "exec", "--interactive", containerName}, langserverCmd...)
 
 	//nolint:gosec // ok
 	langserver := exec.CommandContext(ctx, dockerized[0], dockerized[1:]...)
@@ -122,7 +132,12 @@ func langserverRunGeneric(ctx context.Context, language string) error {
 		return fmt.Errorf("generic language server not found for: %s", language)
 	}
 
-	args := []string{"docker", "run", "--rm", "--interactive", "--workdir=" + wd, "--volume=" + wd + ":" + wd}
+	containerRuntime, err := currentContainerRuntime()
+	if err != nil {
+		return err
+	}
+
+	args := []string{containerRuntime.CLI(), "run", "--rm", "--interactive", "--workdir=" + wd, "--volume=" + wd + ":" + wd}
 	args = append(args, server.dockerOpts...)
 	args = append(args, server.ref)
 	args = append(args, server.args...)
@@ -50,6 +50,8 @@ func main() {
 		app.AddCommand(devEntry())
 		app.AddCommand(infoEntry())
 		app.AddCommand(workspaceEntry())
+		app.AddCommand(verifyArtefactsEntry())
+		app.AddCommand(subreposEntry())
 
 		app.AddCommand(openProjectHomepageEntrypoint())
 
@@ -0,0 +1,159 @@
+package main
+
+// Podman support. Podman serves a Docker-compatible API, so container operations go through the
+// same Engine API client. differences are mostly in the CLI (image builds, pushes, logins) and in
+// rootless mode's user namespace.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/function61/gokit/app/udocker"
+)
+
+type podman struct {
+	dockerEngine
+}
+
+var _ ContainerRuntime = (*podman)(nil)
+
+// honors $CONTAINER_HOST like the `podman` CLI does
+func newPodmanFromEnv() (*podman, error) {
+	withErr := func(err error) (*podman, error) { return nil, fmt.Errorf("newPodmanFromEnv: %w", err) }
+
+	containerHost := firstNonEmpty(os.Getenv("CONTAINER_HOST"), "unix://"+podmanSocket(os.Getenv))
+
+	containerHostURL, err := url.Parse(containerHost)
+	if err != nil {
+		return withErr(err)
+	}
+
+	if containerHostURL.Scheme != "unix" {
+		return withErr(fmt.Errorf("unsupported CONTAINER_HOST: %s", containerHost))
+	}
+
+	if _, err := os.Stat(containerHostURL.Path); err != nil {
+		return withErr(fmt.Errorf("%w (enable Podman's API socket with `$ systemctl --user enable --now podman.socket`)", err))
+	}
+
+	client, baseURL, err := udocker.Client(containerHost, nil, false)
+	if err != nil {
+		return withErr(err)
+	}
+
+	return &podman{dockerEngine{client: client, baseURL: baseURL, runCLI: execCLI}}, nil
+}
+
+func (p *podman) Name() string {
+	return "Podman"
+}
+
+func (p *podman) CLI() string {
+	return "podman"
+}
+
+// rootless Podman maps container's root to the invoking user, so image's default (usually root)
+// already produces files owned by the user. forcing our gid would map to a subordinate gid instead.
+func (p *podman) DevContainerUser() string {
+	return ""
+}
+
+func (p *podman) BuildImage(ctx context.Context, tag string, dockerfilePath string, contextDir string, output io.Writer) error {
+	return buildImageWithCLI(ctx, p.runCLI, p.CLI(), tag, dockerfilePath, contextDir, output)
+}
+
+// builds into a manifest list (= OCI image index) so multi-platform images work like they do with buildx
+func (p *podman) BuildAndPushImage(ctx context.Context, spec imageBuildSpec, output io.Writer) (string, error) {
+	withErr := func(err error) (string, error) { return "", fmt.Errorf("BuildAndPushImage: %w", err) }
+
+	if spec.SBOM || spec.Provenance != "" {
+		return withErr(errors.New("SBOM and provenance attestations are not supported with Podman"))
+	}
+
+	manifestList := spec.Tags[0]
+
+	// `--manifest` adds to an existing list, so remove the one possibly left from previous build
+	_ = p.runCLI(ctx, nil, io.Discard, "podman", "manifest", "rm", manifestList)
+
+	args := []string{
+		"podman",
+		"build",
+		"--file", spec.DockerfilePath,
+		"--manifest", manifestList,
+	}
+
+	if len(spec.Platforms) > 0 {
+		args = append(args, "--platform="+strings.Join(spec.Platforms, ","))
+	}
+
+	for _, annotation := range spec.Annotations {
+		args = append(args, "--annotation="+annotation, "--label="+annotation)
+	}
+
+	args = append(args, spec.ContextDir)
+
+	if err := p.runCLI(ctx, nil, output, args...); err != nil {
+		return withErr(err)
+	}
+
+	// `podman build --annotation` only annotates image manifests. some consumers (like GitHub packages UI)
+	// only show annotations from the image index.
+	if len(spec.Annotations) > 0 {
+		annotateArgs := []string{"podman", "manifest", "annotate", "--index"}
+		for _, annotation := range spec.Annotations {
+			annotateArgs = append(annotateArgs, "--annotation="+annotation)
+		}
+		annotateArgs = append(annotateArgs, manifestList)
+
+		if err := p.runCLI(ctx, nil, output, annotateArgs...); err != nil {
+			return withErr(err)
+		}
+	}
+
+	if !spec.Push {
+		return "", nil
+	}
+
+	digestFile, err := os.CreateTemp("", "bob-podman-digest-*")
+	if err != nil {
+		return withErr(err)
+	}
+	digestFile.Close()
+	defer os.Remove(digestFile.Name())
+
+	// same manifest list pushed under each tag => same digest
+	for _, tag := range spec.Tags {
+		if err := p.runCLI(ctx, nil, output,
+			"podman", "manifest", "push", "--all", "--digestfile="+digestFile.Name(), manifestList, "docker://"+tag,
+		); err != nil {
+			return withErr(err)
+		}
+	}
+
+	digest, err := os.ReadFile(digestFile.Name())
+	if err != nil {
+		return withErr(err)
+	}
+
+	return strings.TrimSpace(string(digest)), nil
+}
+
+func (p *podman) RegistryLogin(ctx context.Context, registry string, username string, password string) error {
+	// via stdin so the password isn't visible in process list
+	return p.runCLI(ctx, strings.NewReader(password), os.Stdout, "podman", "login", "--username", username, "--password-stdin", registry)
+}
+
+// rootless Podman's socket lives in user's runtime dir, rootful one in /run
+func podmanSocket(getenv func(string) string) string {
+	if runtimeDir := getenv("XDG_RUNTIME_DIR"); runtimeDir != "" && os.Getuid() != 0 {
+		return filepath.Join(runtimeDir, "podman", "podman.sock")
+	}
+
+	return "/run/podman/podman.sock"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestPodmanBuildAndPushImage(t *testing.T) {
+	invocations := []string{}
+
+	p := &podman{dockerEngine{runCLI: func(_ context.Context, _ io.Reader, _ io.Writer, args ...string) error {
+		invocations = append(invocations, strings.Join(args, " "))
+
+		for _, arg := range args {
+			if digestFile, is := strings.CutPrefix(arg, "--digestfile="); is {
+				return os.WriteFile(digestFile, []byte("sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592\n"), 0600)
+			}
+		}
+
+		return nil
+	}}}
+
+	digest, err := p.BuildAndPushImage(context.Background(), imageBuildSpec{
+		DockerfilePath: "Dockerfile",
+		ContextDir:     ".",
+		Tags:           []string{"ghcr.io/function61/turbobob:20250718_1205_2c9cd41a", "ghcr.io/function61/turbobob:latest"},
+		Platforms:      []string{"linux/amd64", "linux/arm64"},
+		Annotations:    []string{"org.opencontainers.image.title=turbobob"},
+		Push:           true,
+	}, io.Discard)
+	assert.Ok(t, err)
+	assert.Equal(t, digest, "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592")
+
+	// digest file has a random name
+	digestFileArg := regexp.MustCompile(`--digestfile=\S+`)
+	for i := range invocations {
+		invocations[i] = digestFileArg.ReplaceAllString(invocations[i], "--digestfile=(tmp)")
+	}
+
+	assert.Equal(t, strings.Join(invocations, "\n"), strings.Join([]string{
+		"podman manifest rm ghcr.io/function61/turbobob:20250718_1205_2c9cd41a",
+		"podman build --file Dockerfile --manifest ghcr.io/function61/turbobob:20250718_1205_2c9cd41a --platform=linux/amd64,linux/arm64 --annotation=org.opencontainers.image.title=turbobob --label=org.opencontainers.image.title=turbobob .",
+		"podman manifest annotate --index --annotation=org.opencontainers.image.title=turbobob ghcr.io/function61/turbobob:20250718_1205_2c9cd41a",
+		"podman manifest push --all --digestfile=(tmp) ghcr.io/function61/turbobob:20250718_1205_2c9cd41a docker://ghcr.io/function61/turbobob:20250718_1205_2c9cd41a",
+		"podman manifest push --all --digestfile=(tmp) ghcr.io/function61/turbobob:20250718_1205_2c9cd41a docker://ghcr.io/function61/turbobob:latest",
+	}, "\n"))
+}
@@ -0,0 +1,118 @@
+package main
+
+// Secret files (kubeconfig, signing keys, `.npmrc` etc.) for build containers. the content is
+// written to tmpfs (so it never touches the disk) and bind mounted read-only into the container.
+//
+// (copying the content into a tmpfs mount of the container via the runtime's API would work also
+// with a remote runtime, but Docker doesn't support copying into tmpfs mounts.)
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/function61/gokit/os/osutil"
+	"github.com/function61/turbobob/pkg/bobfile"
+)
+
+const (
+	secretFilesTmpfsDir = "/dev/shm" // tmpfs in pretty much every Linux system
+)
+
+// returns bind mounts for the container. *cleanup* must be called (also on failure) once the container is gone.
+// *ownerUID* is the user the container runs as.
+func materializeSecretFiles(secretFiles []bobfile.SecretFileSpec, tmpfsDir string, ownerUID int) ([]string, func(), error) {
+	noop := func() {}
+	withErr := func(err error) ([]string, func(), error) {
+		return nil, noop, fmt.Errorf("materializeSecretFiles: %w", err)
+	}
+
+	if len(secretFiles) == 0 {
+		return nil, noop, nil
+	}
+
+	tmpfsDirExists, err := osutil.Exists(tmpfsDir)
+	if err != nil {
+		return withErr(err)
+	}
+	if !tmpfsDirExists { // refuse to fall back to disk
+		return withErr(fmt.Errorf("tmpfs not available at %s", tmpfsDir))
+	}
+
+	dir, err := os.MkdirTemp(tmpfsDir, "bob-secrets-") // created as 0700
+	if err != nil {
+		return withErr(err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	binds := []string{}
+	for idx, secretFile := range secretFiles {
+		content, err := secretFileContent(secretFile)
+		if err != nil {
+			cleanup()
+			return withErr(fmt.Errorf("%s: %w", secretFile.Path, err))
+		}
+
+		// named by index, because container paths' basenames can collide
+		hostPath := filepath.Join(dir, strconv.Itoa(idx))
+
+		if err := os.WriteFile(hostPath, content, 0400); err != nil {
+			cleanup()
+			return withErr(err)
+		}
+
+		// owner-only, so the container's user must own it. (root can read it anyway.)
+		if ownerUID != 0 && ownerUID != os.Getuid() {
+			if err := os.Chown(hostPath, ownerUID, -1); err != nil {
+				cleanup()
+				return withErr(fmt.Errorf("%s: giving ownership to builder's user (uid %d): %w", secretFile.Path, ownerUID, err))
+			}
+		}
+
+		binds = append(binds, hostPath+":"+secretFile.Path+":ro")
+	}
+
+	return binds, cleanup, nil
+}
+
+// numeric ID of the user the image's containers run as. user names are looked up from the image's /etc/passwd.
+func imageUserID(image *containerImage, readPasswd func() ([]byte, error)) (int, error) {
+	user, _, _ := strings.Cut(image.User, ":") // group doesn't matter for owner-only permissions
+	if user == "" {
+		return 0, nil // root
+	}
+
+	if uid, err := strconv.Atoi(user); err == nil {
+		return uid, nil
+	}
+
+	passwd, err := readPasswd()
+	if err != nil {
+		return 0, fmt.Errorf("resolving image's user %s: %w", user, err)
+	}
+
+	// "node:x:1000:1000::/home/node:/bin/sh"
+	for _, line := range strings.Split(string(passwd), "\n") {
+		if fields := strings.Split(line, ":"); len(fields) >= 3 && fields[0] == user {
+			return strconv.Atoi(fields[2])
+		}
+	}
+
+	return 0, errors.New("image's user not found in /etc/passwd: " + user)
+}
+
+func secretFileContent(secretFile bobfile.SecretFileSpec) ([]byte, error) {
+	if secretFile.FromEnv != "" {
+		content := os.Getenv(secretFile.FromEnv)
+		if content == "" {
+			return nil, envVarMissingErr(secretFile.FromEnv)
+		}
+
+		return []byte(content), nil
+	}
+
+	return os.ReadFile(secretFile.FromFile) // relative paths work because we're at project root
+}
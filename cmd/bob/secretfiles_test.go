@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+)
+
+func TestMaterializeSecretFiles(t *testing.T) {
+	tmpfsDir := t.TempDir()
+
+	t.Setenv("KUBECONFIG_CONTENT", "apiVersion: v1\n")
+	assert.Ok(t, os.WriteFile(filepath.Join(tmpfsDir, "npmrc"), []byte("//registry.npmjs.org/:_authToken=hunter2\n"), 0600))
+
+	binds, cleanup, err := materializeSecretFiles([]bobfile.SecretFileSpec{
+		{Path: "/root/.kube/config", FromEnv: "KUBECONFIG_CONTENT"},
+		{Path: "/root/.npmrc", FromFile: filepath.Join(tmpfsDir, "npmrc")},
+	}, tmpfsDir, os.Getuid())
+	assert.Ok(t, err)
+
+	assert.Equal(t, len(binds), 2)
+
+	hostPath, containerPath, _ := strings.Cut(binds[0], ":")
+	assert.Equal(t, containerPath, "/root/.kube/config:ro")
+
+	content, err := os.ReadFile(hostPath)
+	assert.Ok(t, err)
+	assert.Equal(t, string(content), "apiVersion: v1\n")
+
+	stat, err := os.Stat(hostPath)
+	assert.Ok(t, err)
+	assert.Equal(t, stat.Mode().Perm(), os.FileMode(0400))
+
+	cleanup()
+
+	_, err = os.Stat(filepath.Dir(hostPath))
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestMaterializeSecretFilesCleansUpOnFailure(t *testing.T) {
+	tmpfsDir := t.TempDir()
+
+	t.Setenv("KUBECONFIG_CONTENT", "apiVersion: v1\n")
+
+	_, _, err := materializeSecretFiles([]bobfile.SecretFileSpec{
+		{Path: "/root/.kube/config", FromEnv: "KUBECONFIG_CONTENT"}, // gets written
+		{Path: "/root/.npmrc", FromEnv: "BOB_TEST_NONEXISTENT"},
+	}, tmpfsDir, os.Getuid())
+	assert.Equal(t, err.Error(), "materializeSecretFiles: /root/.npmrc: ENV var missing: BOB_TEST_NONEXISTENT")
+
+	// nothing left behind
+	entries, err := os.ReadDir(tmpfsDir)
+	assert.Ok(t, err)
+	assert.Equal(t, len(entries), 0)
+}
+
+func TestMaterializeSecretFilesOwnedByContainerUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("giving files to another user needs root")
+	}
+
+	t.Setenv("KUBECONFIG_CONTENT", "apiVersion: v1\n")
+
+	binds, cleanup, err := materializeSecretFiles([]bobfile.SecretFileSpec{
+		{Path: "/home/node/.kube/config", FromEnv: "KUBECONFIG_CONTENT"},
+	}, t.TempDir(), 1000)
+	assert.Ok(t, err)
+	defer cleanup()
+
+	hostPath, _, _ := strings.Cut(binds[0], ":")
+
+	stat, err := os.Stat(hostPath)
+	assert.Ok(t, err)
+	assert.Equal(t, stat.Sys().(*syscall.Stat_t).Uid, uint32(1000))
+}
+
+func TestImageUserID(t *testing.T) {
+	readPasswd := func() ([]byte, error) {
+		return []byte("root:x:0:0:root:/root:/bin/sh\nnode:x:1000:1000::/home/node:/bin/sh\n"), nil
+	}
+
+	for _, tc := range []struct {
+		user     string
+		expected string
+	}{
+		{"", "0"},
+		{"1001", "1001"},
+		{"1001:1001", "1001"},
+		{"node", "1000"},
+		{"node:staff", "1000"},
+		{"nobody", "ERROR: image's user not found in /etc/passwd: nobody"},
+	} {
+		t.Run(tc.user, func(t *testing.T) {
+			uid, err := imageUserID(&containerImage{User: tc.user}, readPasswd)
+
+			result := strconv.Itoa(uid)
+			if err != nil {
+				result = "ERROR: " + err.Error()
+			}
+
+			assert.Equal(t, result, tc.expected)
+		})
+	}
+}
@@ -1,13 +1,222 @@
 package main
 
+// Subrepos are other repositories checked out (at a pinned revision) inside the project.
+// they're cloned on first build / dev, and `$ bob subrepos sync` updates them when the pin changes.
+
 import (
+	"errors"
 	"fmt"
+	"log"
+	"path/filepath"
 
 	"github.com/function61/gokit/os/osutil"
 	"github.com/function61/turbobob/pkg/bobfile"
 	"github.com/function61/turbobob/pkg/versioncontrol"
+	"github.com/samber/lo"
+	"github.com/scylladb/termtables"
+	"github.com/spf13/cobra"
 )
 
+func subreposEntry() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "subrepos",
+		Short: "Subrepo related commands",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "Compare subrepos' checked out revisions against their pinned revisions",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			osutil.ExitIfError(subreposStatus())
+		},
+	})
+
+	force := false
+	syncCmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Clone missing subrepos and update the ones not at their pinned revision",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			osutil.ExitIfError(subreposSync(force))
+		},
+	}
+	syncCmd.Flags().BoolVarP(&force, "force", "f", force, "Update also subrepos with local modifications (discarding them)")
+	cmd.AddCommand(syncCmd)
+
+	return cmd
+}
+
+func subreposStatus() error {
+	bobfile, err := bobfile.Read()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := resolveSubrepoStatuses(".", bobfile.Subrepos)
+	if err != nil {
+		return err
+	}
+
+	table := termtables.CreateTable()
+	table.AddHeaders("Subrepo", "Pinned", "Current", "Status")
+
+	for _, status := range statuses {
+		table.AddRow(status.Subrepo.Destination, status.Subrepo.Revision, lo.Substring(status.Current, 0, 8), status.Description())
+	}
+
+	fmt.Println(table.Render())
+
+	return nil
+}
+
+func subreposSync(force bool) error {
+	bobfile, err := bobfile.Read()
+	if err != nil {
+		return err
+	}
+
+	statuses, err := resolveSubrepoStatuses(".", bobfile.Subrepos)
+	if err != nil {
+		return err
+	}
+
+	skipped := 0
+	for _, status := range statuses {
+		if err := syncSubrepo(".", *status, force); err != nil {
+			if !errors.Is(err, errSubrepoModified) {
+				return err
+			}
+
+			log.Printf("WARN: %s: %v", status.Subrepo.Destination, err)
+			skipped++
+		}
+	}
+
+	if skipped > 0 {
+		return fmt.Errorf("%d subrepo(s) not updated due to local modifications (use --force to discard them)", skipped)
+	}
+
+	return nil
+}
+
+var errSubrepoModified = errors.New("has local modifications")
+
+func syncSubrepo(projectDir string, status subrepoStatus, force bool) error {
+	destination := filepath.Join(projectDir, status.Subrepo.Destination)
+
+	switch {
+	case !status.Cloned:
+		return ensureSubrepoCloned(destination, status.Subrepo)
+	case !status.Drifted():
+		return nil
+	case status.Modified && !force: // updating would discard the modifications
+		return errSubrepoModified
+	}
+
+	printHeading(fmt.Sprintf("Updating subrepo %s to %s", status.Subrepo.Destination, status.Subrepo.Revision))
+
+	repo, err := versioncontrol.ForDir(destination, status.Subrepo.Kind)
+	if err != nil {
+		return err
+	}
+
+	// pinned revision might not yet be fetched
+	if err := repo.Pull(); err != nil {
+		return fmt.Errorf("Pull: %w", err)
+	}
+
+	if err := repo.Update(status.Subrepo.Revision); err != nil {
+		//nolint:staticcheck
+		return fmt.Errorf("Update: %w", err)
+	}
+
+	return nil
+}
+
+type subrepoStatus struct {
+	Subrepo  bobfile.SubrepoSpec
+	Cloned   bool
+	Current  string // revision ID currently checked out
+	Pinned   string // `Subrepo.Revision` resolved to revision ID. empty if not known locally (not yet fetched)
+	Modified bool   // has uncommitted changes
+}
+
+// checked out revision differs from the pinned one
+func (s subrepoStatus) Drifted() bool {
+	return s.Cloned && s.Current != s.Pinned
+}
+
+func (s subrepoStatus) Description() string {
+	description := func() string {
+		switch {
+		case !s.Cloned:
+			return "not cloned"
+		case s.Drifted():
+			return "drifted from pinned revision"
+		default:
+			return "ok"
+		}
+	}()
+
+	if s.Modified {
+		description += ", local modifications"
+	}
+
+	return description
+}
+
+func resolveSubrepoStatuses(projectDir string, subrepos []bobfile.SubrepoSpec) ([]*subrepoStatus, error) {
+	statuses := []*subrepoStatus{}
+	for _, subrepo := range subrepos {
+		status, err := resolveSubrepoStatus(filepath.Join(projectDir, subrepo.Destination), subrepo)
+		if err != nil {
+			return nil, fmt.Errorf("subrepo %s: %w", subrepo.Destination, err)
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func resolveSubrepoStatus(destination string, subrepo bobfile.SubrepoSpec) (*subrepoStatus, error) {
+	exists, err := osutil.Exists(destination)
+	if err != nil {
+		return nil, err
+	}
+
+	if !exists {
+		return &subrepoStatus{Subrepo: subrepo}, nil
+	}
+
+	repo, err := versioncontrol.ForDir(destination, subrepo.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	current, _, err := repo.Identify()
+	if err != nil {
+		return nil, err
+	}
+
+	// error most likely means the pinned revision isn't fetched yet => drifted
+	pinned, _ := repo.ResolveRevision(subrepo.Revision)
+
+	uncommittedFiles, err := repo.UncommittedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return &subrepoStatus{
+		Subrepo:  subrepo,
+		Cloned:   true,
+		Current:  current,
+		Pinned:   pinned,
+		Modified: len(uncommittedFiles) > 0,
+	}, nil
+}
+
 func ensureSubrepoCloned(destination string, subrepo bobfile.SubrepoSpec) error {
 	exists, err := osutil.Exists(destination)
 	if err != nil {
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/function61/turbobob/pkg/bobfile"
+	"github.com/function61/turbobob/pkg/versioncontrol"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestSubrepoStatusAndSync(t *testing.T) {
+	originDir := t.TempDir()
+	projectDir := t.TempDir()
+
+	origin, err := git.PlainInit(originDir, false)
+	assert.Ok(t, err)
+
+	commit := func(content string) string {
+		assert.Ok(t, os.WriteFile(filepath.Join(originDir, "README.md"), []byte(content), 0600))
+
+		worktree, err := origin.Worktree()
+		assert.Ok(t, err)
+		_, err = worktree.Add("README.md")
+		assert.Ok(t, err)
+
+		signature := &object.Signature{Name: "Joonas", Email: "joonas@example.com", When: time.Now()}
+		hash, err := worktree.Commit(content, &git.CommitOptions{Author: signature, Committer: signature})
+		assert.Ok(t, err)
+
+		return hash.String()
+	}
+
+	first := commit("first")
+
+	subrepo := bobfile.SubrepoSpec{Source: originDir, Kind: versioncontrol.KindGit, Destination: "vendor/lib", Revision: first}
+
+	status := func() subrepoStatus {
+		t.Helper()
+
+		statuses, err := resolveSubrepoStatuses(projectDir, []bobfile.SubrepoSpec{subrepo})
+		assert.Ok(t, err)
+
+		return *statuses[0]
+	}
+
+	assert.Equal(t, status().Description(), "not cloned")
+
+	assert.Ok(t, syncSubrepo(projectDir, status(), false))
+	assert.Equal(t, status().Description(), "ok")
+
+	// pin moves to a revision the checkout doesn't have yet
+	subrepo.Revision = commit("second")
+	assert.Equal(t, status().Description(), "drifted from pinned revision")
+
+	// local modifications are not discarded without force
+	assert.Ok(t, os.WriteFile(filepath.Join(projectDir, "vendor/lib/README.md"), []byte("my changes"), 0600))
+	assert.Equal(t, status().Description(), "drifted from pinned revision, local modifications")
+	assert.Assert(t, errors.Is(syncSubrepo(projectDir, status(), false), errSubrepoModified))
+
+	assert.Ok(t, syncSubrepo(projectDir, status(), true))
+	assert.Equal(t, status().Description(), "ok")
+
+	readme, err := os.ReadFile(filepath.Join(projectDir, "vendor/lib/README.md"))
+	assert.Ok(t, err)
+	assert.Equal(t, string(readme), "second")
+}
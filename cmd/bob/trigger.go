@@ -11,29 +11,100 @@ package main
 //
 //     $ bob trigger fire
 //
-// Only one "trigger server" can be active at at time. (If needed, named triggers could be added.)
+// Changes in the filesystem can fire the trigger too (files ignored by .gitignore don't):
+//
+//     $ bob trigger --watch='**/*.go' --ignore='vendor/**' 'bob build --fast'
+//
+// Bursts of fires (within `--debounce` of each other) coalesce into one run. Fire during a run
+// stops it first: SIGTERM to the command's whole process group, SIGKILL after `--grace-period`.
+//
+// Many trigger servers can be active at a time by giving them names:
+//
+//     $ bob trigger --name=test 'go test ./...'
+//     $ bob trigger fire test
+//     $ bob trigger fire --all
+//     $ bob trigger list
+//
+// Each run's status line shows its number and duration. The latest runs can be reviewed with
+// `$ bob trigger history`, and `$ bob trigger notify` (in the host) shows a desktop notification
+// when the command starts failing or passes again.
+//
+// Fire can pass arguments to the command (as "$1", "$2", ..) and wait for the run to complete,
+// exiting with the command's exit code. Handy for editor keybindings that show pass/fail:
+//
+//     $ bob trigger --name=test 'go test ./... -run "${1:-.}"'
+//     $ bob trigger fire --wait test -- TestParser
+//
+// The protocol is a JSON line per connection. A fire carrying arguments supersedes the previous
+// fire's arguments (also fires from --watch, which carry none). A waiter whose run is stopped
+// by a newer fire gets the result of the newer run.
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/function61/gokit/log/logex"
 	"github.com/function61/gokit/net/netutil"
 	"github.com/function61/gokit/os/osutil"
 	"github.com/function61/gokit/sync/taskrunner"
+	"github.com/samber/lo"
 	"github.com/spf13/cobra"
 )
 
 const (
 	// taking advantage of the fact that /tmp/build is bind-mounted to dev containers (for caching)
-	triggerSockPath = "/tmp/build/trigger.sock"
+	triggerSockDir = "/tmp/build"
+
+	triggerDefaultName = "default"
+
+	triggerActionFire    = "fire"
+	triggerActionPing    = "ping"    // liveness check, doesn't fire
+	triggerActionHistory = "history" // responds with recent runs, doesn't fire
 )
 
+// sent by client as a single JSON line. anything else than a valid ping or history request is treated as a fire
+// (older clients closed the connection without sending anything).
+type triggerRequest struct {
+	Action string   `json:"action"`
+	Args   []string `json:"args,omitempty"` // positional parameters for the command
+	Wait   bool     `json:"wait,omitempty"` // respond with triggerResult once the run completes
+}
+
+// response line for fires that wait
+type triggerResult struct {
+	ExitCode int    `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+}
+
+// internal representation of a fire, from any event source
+type triggerFireRequest struct {
+	args   []string
+	result chan<- triggerResult // nil if nobody waits for the result. must be buffered.
+}
+
+var triggerNameRe = regexp.MustCompile(`^[\w-]+$`)
+
 func triggerEntry() *cobra.Command {
+	name := triggerDefaultName
+	opts := triggerOptions{
+		gracePeriod: 5 * time.Second,
+		debounce:    250 * time.Millisecond,
+	}
+
 	cmd := &cobra.Command{
 		Use:   "trigger [commandToRunWhenTriggered]",
 		Short: `Like "watch", but with user-defined event source to run cmds (compile/test/anything)`,
@@ -43,128 +114,456 @@ func triggerEntry() *cobra.Command {
 
 			osutil.ExitIfError(trigger(
 				osutil.CancelOnInterruptOrTerminate(rootLogger),
+				name,
 				args[0],
+				opts,
 				rootLogger))
 		},
 	}
 
-	cmd.AddCommand(&cobra.Command{
-		Use:   "fire",
+	cmd.Flags().StringVarP(&name, "name", "", name, "Name of the trigger, for running many triggers at the same time")
+	cmd.Flags().DurationVarP(&opts.gracePeriod, "grace-period", "", opts.gracePeriod, "How long to wait for running command to exit after SIGTERM before SIGKILL")
+	cmd.Flags().DurationVarP(&opts.debounce, "debounce", "", opts.debounce, "Fires within this window of each other coalesce into a single run")
+	cmd.Flags().StringArrayVarP(&opts.watch, "watch", "", opts.watch, "Also fire on changes to files matching pattern (.gitignore syntax, like '**/*.go'). Files ignored by .gitignore don't fire")
+	cmd.Flags().StringArrayVarP(&opts.ignore, "ignore", "", opts.ignore, "Exclude pattern from --watch (.gitignore syntax, like 'vendor/**')")
+
+	all := false
+	wait := false
+	fireCmd := &cobra.Command{
+		Use:   "fire [name] [-- args...]",
 		Short: "Fire the trigger, usually from event source in the host system",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if dash := cmd.ArgsLenAtDash(); dash > 1 || (dash == -1 && len(args) > 1) {
+				return errors.New("at most one trigger name. pass arguments for the command after --")
+			}
+
+			return nil
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			ctx := osutil.CancelOnInterruptOrTerminate(nil)
+
+			name, cmdArgs := lo.FirstOrEmpty(args), []string{}
+			if dash := cmd.ArgsLenAtDash(); dash != -1 {
+				name, cmdArgs = lo.FirstOrEmpty(args[:dash]), args[dash:]
+			}
+
+			switch {
+			case all && wait:
+				osutil.ExitIfError(errors.New("--wait can't be combined with --all"))
+			case all:
+				osutil.ExitIfError(triggerFireAll(ctx, triggerSockDir, cmdArgs))
+			default:
+				result, err := triggerFire(ctx, triggerSockDir, firstNonEmpty(name, triggerDefaultName), cmdArgs, wait)
+				osutil.ExitIfError(err)
+
+				if result != nil {
+					os.Exit(result.ExitCode)
+				}
+			}
+		},
+	}
+	fireCmd.Flags().BoolVarP(&all, "all", "a", all, "Fire all running triggers")
+	fireCmd.Flags().BoolVarP(&wait, "wait", "w", wait, "Wait for the run to complete and exit with the command's exit code")
+	cmd.AddCommand(fireCmd)
+
+	cmd.AddCommand(triggerHistoryEntry())
+	cmd.AddCommand(triggerNotifyEntry())
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List running triggers",
 		Args:  cobra.NoArgs,
 		Run: func(cmd *cobra.Command, args []string) {
-			osutil.ExitIfError(triggerFire(
-				osutil.CancelOnInterruptOrTerminate(nil)))
+			osutil.ExitIfError(func() error {
+				names, err := triggersRunning(osutil.CancelOnInterruptOrTerminate(nil), triggerSockDir)
+				if err != nil {
+					return err
+				}
+
+				for _, name := range names {
+					fmt.Println(name)
+				}
+
+				return nil
+			}())
 		},
 	})
 
 	return cmd
 }
 
-func triggerFire(ctx context.Context) error {
+type triggerOptions struct {
+	gracePeriod time.Duration // between SIGTERM and SIGKILL when stopping running command
+	debounce    time.Duration // zero runs immediately on each fire
+	watch       []string      // fire on changes to files matching these (.gitignore syntax). empty = no filesystem watch
+	ignore      []string      // exceptions to *watch*
+}
+
+// default trigger keeps the original socket name, so older Bob versions can fire it
+func triggerSockPath(dir string, name string) string {
+	if name == triggerDefaultName {
+		return filepath.Join(dir, "trigger.sock")
+	} else {
+		return filepath.Join(dir, "trigger-"+name+".sock")
+	}
+}
+
+// result is nil if not *wait*ing
+func triggerFire(ctx context.Context, dir string, name string, args []string, wait bool) (*triggerResult, error) {
+	req := triggerRequest{
+		Action: triggerActionFire,
+		Args:   args,
+		Wait:   wait,
+	}
+
+	if !wait {
+		return nil, triggerSendRequest(ctx, triggerSockPath(dir, name), req, nil)
+	}
+
+	result := &triggerResult{}
+	if err := triggerSendRequest(ctx, triggerSockPath(dir, name), req, result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func triggerFireAll(ctx context.Context, dir string, args []string) error {
+	names, err := triggersRunning(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	if len(names) == 0 {
+		return errors.New("no triggers running")
+	}
+
+	for _, name := range names {
+		if _, err := triggerFire(ctx, dir, name, args, false); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// names of triggers whose server answers. sockets of crashed servers are left out.
+func triggersRunning(ctx context.Context, dir string) ([]string, error) {
+	sockPaths, err := filepath.Glob(filepath.Join(dir, "trigger*.sock"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, sockPath := range sockPaths {
+		name := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(filepath.Base(sockPath), "trigger"), "-"), ".sock")
+
+		if err := triggerSendRequest(ctx, sockPath, triggerRequest{Action: triggerActionPing}, nil); err == nil {
+			names = append(names, firstNonEmpty(name, triggerDefaultName))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// response line is decoded into *response*, unless it's nil (= request has no response)
+func triggerSendRequest(ctx context.Context, sockPath string, req triggerRequest, response any) error {
 	// we could use something sophisticated, even a HTTP server, but we use a cheap man's version
-	// where each connection open is the trigger fire. no real data is transmitted in either direction
+	// where each connection is one request line, and optionally one response line.
 
-	client, err := (&net.Dialer{}).DialContext(ctx, "unix", triggerSockPath)
+	client, err := (&net.Dialer{}).DialContext(ctx, "unix", sockPath)
 	if err != nil {
 		return err
 	}
+	defer client.Close()
+
+	// waiting for a run can take long
+	defer context.AfterFunc(ctx, func() { _ = client.Close() })()
+
+	if err := json.NewEncoder(client).Encode(req); err != nil {
+		return err
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(client).Decode(response); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
-	return client.Close()
+		if errors.Is(err, io.EOF) {
+			return errors.New("trigger stopped before responding")
+		}
+
+		return err
+	}
+
+	return nil
 }
 
 // pro-tip: you need to inside the host:
 //
 //	$ chgrp $(id -g) /tmp/build
-func trigger(ctx context.Context, cmd string, logger *log.Logger) error {
-	// this channel gets a signal each time we should activate the trigger
-	triggerFireReq := make(chan void, 1)
+func trigger(ctx context.Context, name string, cmd string, opts triggerOptions, logger *log.Logger) error {
+	if !triggerNameRe.MatchString(name) {
+		return fmt.Errorf("invalid trigger name: %s", name)
+	}
+
+	sockPath := triggerSockPath(triggerSockDir, name)
+
+	// starting a server would take over the socket of the one already running
+	if err := triggerSendRequest(ctx, sockPath, triggerRequest{Action: triggerActionPing}, nil); err == nil {
+		return fmt.Errorf("trigger '%s' is already running", name)
+	}
+
+	// this channel gets a signal each time we should activate the trigger. it has many senders, so it's never closed.
+	triggerFireReq := make(chan triggerFireRequest, 1)
+
+	history := &triggerRunHistory{}
+
+	// before starting anything, so a bad pattern doesn't leave the server (and its socket) running
+	var filter *fsWatchFilter
+	if len(opts.watch) > 0 {
+		var err error
+		filter, err = newFsWatchFilter(".", opts.watch, opts.ignore)
+		if err != nil {
+			return err
+		}
+	}
 
 	tasks := taskrunner.New(ctx, logger)
 
 	// the "UI" for the trigger command. we'll spend most of our time waiting for trigger to fire,
 	// and when it does, we'll run the trigger's target command and display its output + exit code
 	tasks.Start("cmdrunner", func(ctx context.Context) error {
-		var runningCommand *exec.Cmd
-		runningCommandExited := make(chan error, 1)
-		var stopRunningCommand context.CancelFunc
-
-		start := func() {
-			var subCtx context.Context
-			subCtx, stopRunningCommand = context.WithCancel(ctx)
-
-			runningCommand = exec.CommandContext(subCtx, "sh", "-c", cmd)
-			runningCommand.Stdin = os.Stdin
-			runningCommand.Stdout = os.Stdout
-			runningCommand.Stderr = os.Stderr
-
-			go func() {
-				runningCommandExited <- runningCommand.Run()
-			}()
+		return triggerRunCommandOnFires(ctx, cmd, triggerFireReq, opts, history, os.Stdout, os.Stderr)
+	})
+
+	tasks.Start("trigger-server", func(ctx context.Context) error {
+		return triggerServerDeliverIncomingTriggerFires(ctx, sockPath, triggerFireReq, history)
+	})
+
+	if filter != nil {
+		tasks.Start("fs-watch", func(ctx context.Context) error {
+			return triggerWatchFilesystem(ctx, filter, triggerFireReq, logger)
+		})
+	}
+
+	return tasks.Wait()
+}
+
+// runs *cmd* (previous run is stopped first) after each burst of fires
+func triggerRunCommandOnFires(
+	ctx context.Context,
+	cmd string,
+	triggerFireReq <-chan triggerFireRequest,
+	opts triggerOptions,
+	history *triggerRunHistory,
+	output io.Writer,
+	statusOutput io.Writer,
+) error {
+	var runningCommand *exec.Cmd
+	var run triggerRun // of runningCommand
+	runningCommandExited := make(chan error, 1)
+
+	// latest fire's arguments, and waiters for the run that hasn't started yet
+	pendingArgs := []string{}
+	pendingWaiters := []chan<- triggerResult{}
+	// waiters for the running command (also those whose run it superseded)
+	runningWaiters := []chan<- triggerResult{}
+
+	// *stopReason* is empty if the run completed
+	handleStopped := func(err error, stopReason string) {
+		run.Duration = time.Since(run.Started).Round(time.Millisecond)
+		run.Stopped = stopReason
+		run.triggerResult = triggerResultFromErr(err)
+		history.Add(run)
+
+		// show easy-to-read status line for its exit. we've just shown stdout/stderr above this
+		fmt.Fprintf(statusOutput, "╰╴╴ %s\n", run.Summary())
+
+		runningCommand = nil
+	}
+
+	// run completed (or failed to start)
+	handleCompleted := func(err error) {
+		handleStopped(err, "")
+
+		for _, waiter := range runningWaiters {
+			waiter <- run.triggerResult
 		}
+		runningWaiters = nil
+	}
 
-		handleStopped := func(err error) {
-			// show easy-to-read status line for its exit. we've just shown stdout/stderr above this
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "╰╴╴ ✗: %s\n", err.Error())
-			} else {
-				fmt.Fprintf(os.Stderr, "╰╴╴ ✓\n")
-			}
+	start := func() {
+		runningWaiters = append(runningWaiters, pendingWaiters...)
+		pendingWaiters = nil
+
+		run = triggerRun{Number: run.Number + 1, Args: pendingArgs, Started: time.Now()}
 
-			runningCommand = nil
+		// args become "$1", "$2", .. ("sh" is "$0"), so they need no quoting
+		runningCommand = exec.Command("sh", append([]string{"-c", cmd, "sh"}, pendingArgs...)...)
+		runningCommand.Stdout = output
+		runningCommand.Stderr = output
+		// own process group so stopping reaches also the processes `sh` started. (as a background
+		// process group it can't read from the terminal, so stdin is not connected.)
+		runningCommand.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+		if err := runningCommand.Start(); err != nil {
+			handleCompleted(err)
+			return
 		}
 
-		stopIfRunning := func() {
-			if runningCommand != nil {
-				// TODO: graceful stop instead of forced kill
-				stopRunningCommand()
+		go func(runningCommand *exec.Cmd) {
+			runningCommandExited <- runningCommand.Wait()
+		}(runningCommand)
+	}
 
-				handleStopped(<-runningCommandExited)
-			}
+	// waiters are left waiting, so they get the result of the next run
+	stopIfRunning := func(reason string) {
+		if runningCommand != nil {
+			handleStopped(stopProcessGroup(runningCommand.Process.Pid, runningCommandExited, opts.gracePeriod), reason)
 		}
+	}
 
-		for {
-			select {
-			case <-ctx.Done():
-				stopIfRunning()
+	// stopped timer whose channel is drained, so Reset() works (go.mod predates Go 1.23's synchronous timers)
+	debounceTimer := time.NewTimer(time.Hour)
+	debounceTimer.Stop()
+	defer debounceTimer.Stop()
 
-				return nil
-			case err := <-runningCommandExited: // spontaneous stop
-				handleStopped(err)
-			case <-triggerFireReq:
-				stopIfRunning()
+	for {
+		select {
+		case <-ctx.Done():
+			stopIfRunning(triggerStoppedByShutdown)
 
-				start()
+			return nil
+		case err := <-runningCommandExited: // spontaneous stop
+			handleCompleted(err)
+		case fire := <-triggerFireReq:
+			pendingArgs = fire.args
+			if fire.result != nil {
+				pendingWaiters = append(pendingWaiters, fire.result)
 			}
+
+			// each fire within the window postpones the run. a tick of a timer that expired just now
+			// must be drained, or it'd start the run right away and the reset timer would restart it.
+			if !debounceTimer.Stop() {
+				select {
+				case <-debounceTimer.C:
+				default:
+				}
+			}
+			debounceTimer.Reset(opts.debounce)
+		case <-debounceTimer.C:
+			stopIfRunning(triggerStoppedByNewerFire)
+
+			start()
 		}
-	})
+	}
+}
 
-	tasks.Start("trigger-server", func(ctx context.Context) error {
-		return triggerServerDeliverIncomingTriggerFires(ctx, triggerFireReq)
-	})
+func triggerResultFromErr(err error) triggerResult {
+	if err == nil {
+		return triggerResult{ExitCode: 0}
+	}
 
-	return tasks.Wait()
+	exitCode := 1 // didn't even start
+	if exitErr := (*exec.ExitError)(nil); errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+
+		// like shells report it
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			exitCode = 128 + int(status.Signal())
+		}
+	}
+
+	return triggerResult{ExitCode: exitCode, Error: err.Error()}
 }
 
-func triggerServerDeliverIncomingTriggerFires(ctx context.Context, triggerFireReq chan<- void) error {
-	defer close(triggerFireReq)
+// SIGTERM, and SIGKILL if process group hasn't exited within *gracePeriod*. returns the exit error.
+func stopProcessGroup(pid int, exited <-chan error, gracePeriod time.Duration) error {
+	// negative pid = process group
+	_ = syscall.Kill(-pid, syscall.SIGTERM)
 
-	return netutil.ListenUnixAllowOwnerAndGroup(ctx, triggerSockPath, func(listener net.Listener) error {
-		for {
-			client, err := listener.Accept()
-			if err != nil {
-				if ctx.Err() != nil {
-					return nil // context canceled
-				} else {
-					return err // actual error
-				}
+	select {
+	case err := <-exited:
+		return err
+	case <-time.After(gracePeriod):
+		_ = syscall.Kill(-pid, syscall.SIGKILL)
+
+		return <-exited
+	}
+}
+
+func triggerServerDeliverIncomingTriggerFires(
+	ctx context.Context,
+	sockPath string,
+	triggerFireReq chan<- triggerFireRequest,
+	history *triggerRunHistory,
+) error {
+	return netutil.ListenUnixAllowOwnerAndGroup(ctx, sockPath, func(listener net.Listener) error {
+		// each connection on its own goroutine, because waiting clients keep theirs open for the whole run
+		err := netutil.CancelableServe(ctx, listener, func(client net.Conn) {
+			defer client.Close()
+
+			req := triggerReadRequest(client)
+
+			switch req.Action {
+			case triggerActionPing:
+				return
+			case triggerActionHistory:
+				_ = json.NewEncoder(client).Encode(history.Runs())
+				return
+			}
+
+			var result chan triggerResult
+			if req.Wait {
+				result = make(chan triggerResult, 1)
 			}
 
-			triggerFireReq <- void{}
+			select {
+			case triggerFireReq <- triggerFireRequest{args: req.Args, result: result}:
+			case <-ctx.Done():
+				return
+			}
+
+			if result == nil {
+				return
+			}
 
-			_ = client.Close() // cleanup, conn open only used as a trigger signal
+			select {
+			case res := <-result:
+				_ = json.NewEncoder(client).Encode(res)
+			case <-ctx.Done(): // client notices from closed connection
+			}
+		})
+		if errors.Is(err, net.ErrClosed) { // ListenUnix..() also closes the listener on cancel
+			return nil
 		}
+
+		return err
 	})
 }
 
-type void struct{}
+// treats anything else than a valid ping or history request as fire
+func triggerReadRequest(client net.Conn) triggerRequest {
+	// don't let a stuck client block its fire
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+
+	line, _ := bufio.NewReader(client).ReadBytes('\n')
+
+	req := triggerRequest{}
+	if err := json.Unmarshal(line, &req); err != nil {
+		return triggerRequest{Action: triggerActionFire}
+	}
+
+	switch req.Action {
+	case triggerActionPing, triggerActionHistory:
+		return req
+	default:
+		return triggerRequest{Action: triggerActionFire, Args: req.Args, Wait: req.Wait}
+	}
+}
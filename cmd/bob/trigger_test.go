@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestStopProcessGroup(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		cmd      string
+		expected string
+	}{
+		// the subshell is a child of `sh`, so it'd survive if only `sh` was signaled
+		{"graceful", "(sleep 0.5; touch $MARKER) & wait", "signal: terminated"},
+		// ignored signals are inherited, so the subshell ignores SIGTERM too
+		{"ignores SIGTERM", "trap '' TERM; (sleep 0.5; touch $MARKER) & wait", "signal: killed"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			marker := filepath.Join(t.TempDir(), "survived")
+
+			cmd := exec.Command("sh", "-c", tc.cmd)
+			cmd.Env = append(os.Environ(), "MARKER="+marker)
+			cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+			assert.Ok(t, cmd.Start())
+
+			exited := make(chan error, 1)
+			go func() {
+				exited <- cmd.Wait()
+			}()
+
+			time.Sleep(100 * time.Millisecond) // let `sh` set its trap and start the subshell
+
+			err := stopProcessGroup(cmd.Process.Pid, exited, 200*time.Millisecond)
+			assert.Equal(t, err.Error(), tc.expected)
+
+			time.Sleep(600 * time.Millisecond) // subshell would've touched the marker by now
+
+			_, err = os.Stat(marker)
+			assert.Assert(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestTriggerDebounce(t *testing.T) {
+	runsFile := filepath.Join(t.TempDir(), "runs")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	triggerFireReq := make(chan triggerFireRequest)
+	runnerStopped := make(chan error, 1)
+	go func() {
+		runnerStopped <- triggerRunCommandOnFires(ctx, "echo run >> "+runsFile, triggerFireReq, triggerOptions{
+			gracePeriod: time.Second,
+			debounce:    200 * time.Millisecond,
+		}, &triggerRunHistory{}, os.Stdout, &strings.Builder{})
+	}()
+
+	for i := 0; i < 5; i++ { // burst
+		triggerFireReq <- triggerFireRequest{}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	cancel()
+	assert.Ok(t, <-runnerStopped)
+
+	runs, err := os.ReadFile(runsFile)
+	assert.Ok(t, err)
+	assert.Equal(t, string(runs), "run\n")
+}
+
+func TestNamedTriggers(t *testing.T) {
+	dir := t.TempDir()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fires := map[string]chan triggerFireRequest{}
+	serversStopped := make(chan error, 2)
+	for _, name := range []string{triggerDefaultName, "test"} {
+		fires[name] = make(chan triggerFireRequest, 10)
+		go func(sockPath string, fire chan triggerFireRequest) {
+			serversStopped <- triggerServerDeliverIncomingTriggerFires(ctx, sockPath, fire, &triggerRunHistory{})
+		}(triggerSockPath(dir, name), fires[name])
+	}
+
+	// crashed server leaves its socket behind
+	assert.Ok(t, os.WriteFile(filepath.Join(dir, "trigger-crashed.sock"), nil, 0600))
+
+	names := func() string {
+		t.Helper()
+
+		// servers start asynchronously
+		for i := 0; i < 50; i++ {
+			names, err := triggersRunning(ctx, dir)
+			assert.Ok(t, err)
+
+			if len(names) == 2 {
+				return strings.Join(names, ",")
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		return ""
+	}
+
+	assert.Equal(t, names(), "default,test")
+
+	_, err := triggerFire(ctx, dir, "test", nil, false)
+	assert.Ok(t, err)
+	assert.Ok(t, triggerFireAll(ctx, dir, nil))
+
+	received := func(name string) {
+		t.Helper()
+
+		select {
+		case <-fires[name]:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: fire not received", name)
+		}
+	}
+
+	received(triggerDefaultName)
+	received("test")
+	received("test")
+
+	cancel()
+	for range fires {
+		assert.Ok(t, <-serversStopped)
+	}
+
+	// pings from listing weren't fires
+	for _, fire := range fires {
+		assert.Equal(t, len(fire), 0)
+	}
+}
+
+func TestTriggerShutdownStopsRun(t *testing.T) {
+	started := filepath.Join(t.TempDir(), "started")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	triggerFireReq := make(chan triggerFireRequest, 1)
+	history := &triggerRunHistory{}
+	runnerStopped := make(chan error, 1)
+	go func() {
+		runnerStopped <- triggerRunCommandOnFires(ctx, "touch "+started+" && sleep 10", triggerFireReq, triggerOptions{
+			gracePeriod: time.Second,
+		}, history, &strings.Builder{}, &strings.Builder{})
+	}()
+
+	triggerFireReq <- triggerFireRequest{}
+
+	for i := 0; ; i++ {
+		if _, err := os.Stat(started); err == nil {
+			break
+		}
+
+		if i == 50 {
+			t.Fatal("command didn't start")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	assert.Ok(t, <-runnerStopped)
+
+	runs := history.Runs()
+	assert.Equal(t, len(runs), 1)
+	assert.Equal(t, runs[0].Summary(), fmt.Sprintf("■ #1 (%s): stopped by trigger shutting down", runs[0].Duration))
+}
+
+func TestTriggerFireWait(t *testing.T) {
+	sockPath := triggerSockPath(t.TempDir(), triggerDefaultName)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	triggerFireReq := make(chan triggerFireRequest, 1)
+	history := &triggerRunHistory{}
+	stopped := make(chan error, 2)
+	go func() {
+		stopped <- triggerServerDeliverIncomingTriggerFires(ctx, sockPath, triggerFireReq, history)
+	}()
+	go func() {
+		stopped <- triggerRunCommandOnFires(ctx, `test "$1" = "with space" || exit "$1"`, triggerFireReq, triggerOptions{
+			gracePeriod: time.Second,
+		}, history, &strings.Builder{}, &strings.Builder{})
+	}()
+
+	fireAndWait := func(args ...string) triggerResult {
+		t.Helper()
+
+		// server starts asynchronously
+		for i := 0; i < 50; i++ {
+			result := triggerResult{}
+			if err := triggerSendRequest(ctx, sockPath, triggerRequest{Action: triggerActionFire, Args: args, Wait: true}, &result); err == nil {
+				return result
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatal("server not answering")
+		return triggerResult{}
+	}
+
+	assert.Equal(t, fireAndWait("with space").ExitCode, 0)
+
+	failed := fireAndWait("3")
+	assert.Equal(t, failed.ExitCode, 3)
+	assert.Equal(t, failed.Error, "exit status 3")
+
+	runs := []triggerRun{}
+	assert.Ok(t, triggerSendRequest(ctx, sockPath, triggerRequest{Action: triggerActionHistory}, &runs))
+	assert.Equal(t, len(runs), 2)
+	assert.Equal(t, runs[0].Number, 1)
+	assert.Equal(t, strings.Join(runs[0].Args, ","), "with space")
+	assert.Equal(t, runs[1].Summary(), fmt.Sprintf("✗ #2 (%s): exit status 3", runs[1].Duration))
+
+	cancel()
+	assert.Ok(t, <-stopped)
+	assert.Ok(t, <-stopped)
+}
@@ -0,0 +1,215 @@
+package main
+
+// Trigger run history: retrievable from the trigger server, and host-side desktop notifications
+// when the command starts failing or passes again.
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/function61/gokit/os/osutil"
+	"github.com/samber/lo"
+	"github.com/scylladb/termtables"
+	"github.com/spf13/cobra"
+)
+
+const triggerHistoryLength = 20
+
+// why a run was stopped before completing
+const (
+	triggerStoppedByNewerFire = "stopped by newer fire"
+	triggerStoppedByShutdown  = "stopped by trigger shutting down"
+)
+
+type triggerRun struct {
+	Number   int           `json:"number"` // counts from 1 since the trigger started
+	Args     []string      `json:"args,omitempty"`
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Stopped  string        `json:"stopped,omitempty"` // reason, if stopped before completing
+	triggerResult
+}
+
+func (r triggerRun) Ok() bool {
+	return r.ExitCode == 0 && r.Error == ""
+}
+
+// "✓ #3 (1.2s)" or "✗ #4 (0.8s): exit status 1"
+func (r triggerRun) Summary() string {
+	summary := fmt.Sprintf("#%d (%s)", r.Number, r.Duration)
+
+	switch {
+	case r.Stopped != "":
+		return "■ " + summary + ": " + r.Stopped
+	case r.Ok():
+		return "✓ " + summary
+	default:
+		return "✗ " + summary + ": " + r.Error
+	}
+}
+
+// ring buffer of the latest runs. safe for concurrent use (runner adds, server reads).
+type triggerRunHistory struct {
+	runs []triggerRun // oldest first
+	mu   sync.Mutex
+}
+
+func (h *triggerRunHistory) Add(run triggerRun) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.runs) == triggerHistoryLength {
+		h.runs = append(h.runs[:0], h.runs[1:]...)
+	}
+
+	h.runs = append(h.runs, run)
+}
+
+func (h *triggerRunHistory) Runs() []triggerRun {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]triggerRun{}, h.runs...)
+}
+
+func triggerHistory(ctx context.Context, dir string, name string) ([]triggerRun, error) {
+	runs := []triggerRun{}
+	return runs, triggerSendRequest(ctx, triggerSockPath(dir, name), triggerRequest{Action: triggerActionHistory}, &runs)
+}
+
+// remembers the status of the latest completed run it has seen
+type triggerStatusTracker struct {
+	lastNumber int
+	lastOk     *bool
+}
+
+// returns the runs (since last observation) whose status differs from the completed run before them
+func (t *triggerStatusTracker) Observe(runs []triggerRun) []triggerRun {
+	if len(runs) > 0 && runs[len(runs)-1].Number < t.lastNumber { // trigger was restarted
+		t.lastNumber = 0
+	}
+
+	changes := []triggerRun{}
+	for _, run := range runs {
+		if run.Number <= t.lastNumber {
+			continue
+		}
+		t.lastNumber = run.Number
+
+		if run.Stopped != "" { // didn't complete, so tells nothing about status
+			continue
+		}
+
+		if ok := run.Ok(); t.lastOk == nil || *t.lastOk != ok {
+			if t.lastOk != nil {
+				changes = append(changes, run)
+			}
+
+			t.lastOk = &ok
+		}
+	}
+
+	return changes
+}
+
+func triggerHistoryEntry() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history [name]",
+		Short: "Show the latest runs of the trigger",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			osutil.ExitIfError(func() error {
+				runs, err := triggerHistory(osutil.CancelOnInterruptOrTerminate(nil), triggerSockDir, firstNonEmpty(lo.FirstOrEmpty(args), triggerDefaultName))
+				if err != nil {
+					return err
+				}
+
+				if len(runs) == 0 {
+					fmt.Println("no runs yet")
+					return nil
+				}
+
+				tbl := termtables.CreateTable()
+				tbl.AddHeaders("#", "Started", "Duration", "Args", "Result")
+
+				for _, run := range runs {
+					result := "✓"
+					switch {
+					case run.Stopped != "":
+						result = "■ " + run.Stopped
+					case !run.Ok():
+						result = "✗ " + run.Error
+					}
+
+					tbl.AddRow(
+						strconv.Itoa(run.Number),
+						run.Started.Format("15:04:05"),
+						run.Duration.String(),
+						strings.Join(run.Args, " "),
+						result)
+				}
+
+				fmt.Println(tbl.Render())
+
+				return nil
+			}())
+		},
+	}
+}
+
+func triggerNotifyEntry() *cobra.Command {
+	interval := time.Second
+
+	cmd := &cobra.Command{
+		Use:   "notify [name]",
+		Short: "Show desktop notification when trigger's command starts failing or passes again (run in the host)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			osutil.ExitIfError(triggerNotifyStatusChanges(
+				osutil.CancelOnInterruptOrTerminate(nil),
+				firstNonEmpty(lo.FirstOrEmpty(args), triggerDefaultName),
+				interval))
+		},
+	}
+
+	cmd.Flags().DurationVarP(&interval, "interval", "", interval, "How often to check the trigger's history")
+
+	return cmd
+}
+
+func triggerNotifyStatusChanges(ctx context.Context, name string, interval time.Duration) error {
+	if _, err := exec.LookPath("notify-send"); err != nil {
+		return fmt.Errorf("desktop notifications need notify-send: %w", err)
+	}
+
+	tracker := &triggerStatusTracker{}
+	seenHistory := false // changes before we started aren't news
+
+	for {
+		// trigger not running (yet, or restarting) is not an error
+		if runs, err := triggerHistory(ctx, triggerSockDir, name); err == nil {
+			for _, run := range tracker.Observe(runs) {
+				if !seenHistory {
+					continue
+				}
+
+				if err := exec.CommandContext(ctx, "notify-send", "--app-name=bob", "bob trigger "+name, run.Summary()).Run(); err != nil {
+					return fmt.Errorf("notify-send: %w", err)
+				}
+			}
+
+			seenHistory = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
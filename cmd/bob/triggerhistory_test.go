@@ -0,0 +1,48 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestTriggerRunHistory(t *testing.T) {
+	history := &triggerRunHistory{}
+	for i := 1; i <= triggerHistoryLength+5; i++ {
+		history.Add(triggerRun{Number: i})
+	}
+
+	runs := history.Runs()
+	assert.Equal(t, len(runs), triggerHistoryLength)
+	assert.Equal(t, runs[0].Number, 6)
+	assert.Equal(t, runs[len(runs)-1].Number, triggerHistoryLength+5)
+}
+
+func TestTriggerStatusTracker(t *testing.T) {
+	ok := func(number int) triggerRun { return triggerRun{Number: number} }
+	failed := func(number int) triggerRun {
+		return triggerRun{Number: number, triggerResult: triggerResult{ExitCode: 1, Error: "exit status 1"}}
+	}
+	stopped := func(number int) triggerRun {
+		return triggerRun{Number: number, Stopped: triggerStoppedByNewerFire, triggerResult: triggerResult{ExitCode: 143, Error: "signal: terminated"}}
+	}
+
+	changedNumbers := func(changes []triggerRun) string {
+		numbers := []string{}
+		for _, change := range changes {
+			numbers = append(numbers, change.Summary()[:len("✓ #1")])
+		}
+
+		return strings.Join(numbers, ",")
+	}
+
+	tracker := &triggerStatusTracker{}
+
+	assert.Equal(t, changedNumbers(tracker.Observe([]triggerRun{ok(1), failed(2), ok(3)})), "✗ #2,✓ #3")
+	// same runs again, and runs stopped by newer fires don't count
+	assert.Equal(t, changedNumbers(tracker.Observe([]triggerRun{ok(1), failed(2), ok(3), stopped(4), ok(5)})), "")
+	assert.Equal(t, changedNumbers(tracker.Observe([]triggerRun{ok(5), stopped(6), failed(7), failed(8)})), "✗ #7")
+	// trigger restarted, numbering starts over
+	assert.Equal(t, changedNumbers(tracker.Observe([]triggerRun{ok(1)})), "✓ #1")
+}
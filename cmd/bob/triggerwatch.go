@@ -0,0 +1,77 @@
+package main
+
+// Filesystem watch as an event source for trigger: "$ bob trigger --watch='**/*.go' 'bob build --fast'"
+// gives watch-mode rebuilds (also inside dev containers) without extra tools.
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// decides which changes fire the trigger. patterns use .gitignore syntax.
+type fsWatchFilter struct {
+	rootDir    string
+	watch      gitignore.Matcher
+	ignore     gitignore.Matcher
+	gitignored gitignore.Matcher
+}
+
+func newFsWatchFilter(rootDir string, watchPatterns []string, ignorePatterns []string) (*fsWatchFilter, error) {
+	filter := &fsWatchFilter{
+		rootDir: rootDir,
+		watch:   gitignore.NewMatcher(parseGitignorePatterns(watchPatterns)),
+		ignore:  gitignore.NewMatcher(parseGitignorePatterns(ignorePatterns)),
+	}
+
+	if err := filter.ReloadGitignore(); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// reads .gitignore files of the whole tree (+ .git/info/exclude)
+func (f *fsWatchFilter) ReloadGitignore() error {
+	patterns, err := gitignore.ReadPatterns(osfs.New(f.rootDir), nil)
+	if err != nil {
+		return err
+	}
+
+	f.gitignored = gitignore.NewMatcher(patterns)
+
+	return nil
+}
+
+// *path* is relative to root dir
+func (f *fsWatchFilter) Matches(path string) bool {
+	pathSplit := splitSlashPath(path)
+
+	return f.watch.Match(pathSplit, false) && !f.ignore.Match(pathSplit, false) && !f.gitignored.Match(pathSplit, false)
+}
+
+// whether to not watch directory at all. *path* is relative to root dir.
+func (f *fsWatchFilter) SkipDir(path string) bool {
+	if path == "." {
+		return false
+	}
+
+	pathSplit := splitSlashPath(path)
+
+	return pathSplit[0] == ".git" || f.ignore.Match(pathSplit, true) || f.gitignored.Match(pathSplit, true)
+}
+
+func parseGitignorePatterns(patterns []string) []gitignore.Pattern {
+	parsed := []gitignore.Pattern{}
+	for _, pattern := range patterns {
+		parsed = append(parsed, gitignore.ParsePattern(pattern, nil))
+	}
+
+	return parsed
+}
+
+func splitSlashPath(path string) []string {
+	return strings.Split(filepath.ToSlash(path), "/")
+}
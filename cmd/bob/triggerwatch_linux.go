@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// writes are noticed when the file is closed (instead of each write). editors that save by
+	// renaming a temp file over the original produce IN_MOVED_TO.
+	inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+)
+
+// fires the trigger on changes to files that pass *filter*. inotify watches are per directory,
+// so each (non-skipped) directory is watched separately, including ones created later.
+// subdirectories we can't watch (no access, watch limit reached) are skipped with a warning.
+func triggerWatchFilesystem(ctx context.Context, filter *fsWatchFilter, triggerFireReq chan<- triggerFireRequest, logger *log.Logger) error {
+	withErr := func(err error) error { return fmt.Errorf("triggerWatchFilesystem: %w", err) }
+
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return withErr(err)
+	}
+
+	// non-blocking fd goes through Go's poller, so Close() unblocks Read()
+	inotify := os.NewFile(uintptr(fd), "inotify")
+
+	go func() {
+		<-ctx.Done()
+		_ = inotify.Close()
+	}()
+
+	watchedDirs := map[int]string{} // watch descriptor => dir relative to root
+
+	warnedWatchLimit := false // once is enough, as the rest of the directories would fail also
+
+	// not being able to watch the root means we can't do our job
+	skipSubdir := func(relPath string, err error) error {
+		if relPath == "." {
+			return err
+		}
+
+		switch {
+		case errors.Is(err, syscall.ENOSPC):
+			if !warnedWatchLimit {
+				logger.Printf("not watching %s (and possibly others): inotify watch limit reached (sysctl fs.inotify.max_user_watches)", relPath)
+				warnedWatchLimit = true
+			}
+		default:
+			logger.Printf("not watching %s: %v", relPath, err)
+		}
+
+		return filepath.SkipDir
+	}
+
+	// returns whether *dir* has files that pass the filter. (files can be created in a new dir
+	// before we get to watch it.)
+	watchRecursively := func(dir string) (bool, error) {
+		hasMatchingFiles := false
+
+		err := filepath.WalkDir(filepath.Join(filter.rootDir, dir), func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) { // removed while walking
+					return nil
+				}
+
+				if entry != nil && entry.IsDir() && errors.Is(err, fs.ErrPermission) { // can't list dir
+					relPath, _ := filepath.Rel(filter.rootDir, path)
+					return skipSubdir(relPath, err)
+				}
+
+				return err
+			}
+
+			relPath, err := filepath.Rel(filter.rootDir, path)
+			if err != nil {
+				return err
+			}
+
+			if !entry.IsDir() {
+				hasMatchingFiles = hasMatchingFiles || filter.Matches(relPath)
+				return nil
+			}
+
+			if filter.SkipDir(relPath) {
+				return filepath.SkipDir
+			}
+
+			wd, err := syscall.InotifyAddWatch(fd, path, inotifyMask)
+			if err != nil {
+				return skipSubdir(relPath, fmt.Errorf("%s: %w", path, err))
+			}
+
+			watchedDirs[wd] = relPath
+
+			return nil
+		})
+
+		return hasMatchingFiles, err
+	}
+
+	if _, err := watchRecursively("."); err != nil {
+		return withErr(err)
+	}
+
+	fire := func() {
+		select {
+		case triggerFireReq <- triggerFireRequest{}:
+		case <-ctx.Done():
+		}
+	}
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := inotify.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil // context canceled
+			} else {
+				return withErr(err) // actual error
+			}
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+			switch {
+			case event.Mask&syscall.IN_Q_OVERFLOW != 0: // events were lost. they might've been relevant.
+				fire()
+				continue
+			case event.Mask&syscall.IN_IGNORED != 0: // watched dir was removed
+				delete(watchedDirs, int(event.Wd))
+				continue
+			}
+
+			dir, known := watchedDirs[int(event.Wd)]
+			if !known {
+				continue
+			}
+
+			path := filepath.Join(dir, strings.TrimRight(string(nameBytes), "\x00"))
+
+			if event.Mask&syscall.IN_ISDIR != 0 {
+				if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					hasMatchingFiles, err := watchRecursively(path)
+					if err != nil {
+						return withErr(err)
+					}
+
+					if hasMatchingFiles {
+						fire()
+					}
+				}
+
+				continue
+			}
+
+			if filepath.Base(path) == ".gitignore" {
+				if err := filter.ReloadGitignore(); err != nil {
+					return withErr(err)
+				}
+			}
+
+			if filter.Matches(path) {
+				fire()
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/log/logex"
+	"github.com/function61/gokit/testing/assert"
+)
+
+func TestTriggerWatchFilesystem(t *testing.T) {
+	rootDir := t.TempDir()
+
+	write := func(path string) {
+		t.Helper()
+
+		assert.Ok(t, os.MkdirAll(filepath.Dir(filepath.Join(rootDir, path)), 0700))
+		assert.Ok(t, os.WriteFile(filepath.Join(rootDir, path), []byte("package main"), 0600))
+	}
+
+	write(".gitignore")
+	assert.Ok(t, os.WriteFile(filepath.Join(rootDir, ".gitignore"), []byte("build/\n"), 0600))
+	write("build/generated.go")
+	write("vendor/lib/lib.go")
+
+	filter, err := newFsWatchFilter(rootDir, []string{"**/*.go"}, []string{"vendor/**"})
+	assert.Ok(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	triggerFireReq := make(chan triggerFireRequest, 10)
+	watchStopped := make(chan error, 1)
+	go func() {
+		watchStopped <- triggerWatchFilesystem(ctx, filter, triggerFireReq, logex.Discard)
+	}()
+
+	time.Sleep(100 * time.Millisecond) // let watches be set up
+
+	fired := func() bool {
+		t.Helper()
+
+		select {
+		case <-triggerFireReq:
+			return true
+		case <-time.After(300 * time.Millisecond):
+			return false
+		}
+	}
+
+	write("README.md") // not watched
+	write("vendor/lib/lib.go")
+	write("build/generated.go") // ignored by .gitignore
+	assert.Assert(t, !fired())
+
+	write("main.go")
+	assert.Assert(t, fired())
+
+	write("pkg/newpkg/newpkg.go") // new dirs get watched too
+	assert.Assert(t, fired())
+	write("pkg/newpkg/newpkg.go")
+	assert.Assert(t, fired())
+
+	cancel()
+	assert.Ok(t, <-watchStopped)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+)
+
+func triggerWatchFilesystem(_ context.Context, _ *fsWatchFilter, _ chan<- triggerFireRequest, _ *log.Logger) error {
+	return errors.New("filesystem watch is only supported on Linux")
+}
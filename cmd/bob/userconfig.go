@@ -26,6 +26,7 @@ type UserconfigFile struct {
 	WindowManagerShowProjectEmojiIcons bool               `json:"windowmanager_show_project_emoji_icons"` // needs to be opt-in, because emojis can show up as garbage
 	CodeEditor                         *programConfig     `json:"code_editor"`                            // .cmd can contain "$PROJECT_ROOT" if you need path to project as arg
 	FileBrowser                        *programConfig     `json:"file_browser"`                           // .cmd can contain "$DIRECTORY" if your file browser doesn't use its workdir
+	ContainerRuntime                   string             `json:"container_runtime"`                      // "docker" | "podman". autodetected if not set
 	ProjectQuality                     struct {
 		BuilderUsesExpect map[string]string `json:"builder_uses_expect"` // substring => full string mappings
 		FileRules         []FileQualityRule `json:"file_rules"`
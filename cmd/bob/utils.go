@@ -38,10 +38,6 @@ func allDevShellCommands(devShellCommands []bobfile.DevShellCommand) []string {
 	return commands
 }
 
-func runningInGitHubActions() bool {
-	return os.Getenv("GITHUB_ACTIONS") == "true"
-}
-
 func must(input builderUsesType, _ string, err error) builderUsesType {
 	if err != nil {
 		panic(err)
@@ -60,16 +56,23 @@ func findBuilder(projectFile *bobfile.Bobfile, builderName string) (*bobfile.Bui
 }
 
 func withLogLineGroup(group string, work func() error) error {
-	if !runningInGitHubActions() {
+	ciProvider := currentCIProvider()
+	if ciProvider == nil {
+		printHeading(group)
+		return work()
+	}
+
+	groupStart, groupEnd := ciProvider.LogLineGroup(group)
+	if groupStart == "" { // CI system doesn't support groups
 		printHeading(group)
 		return work()
 	}
 
-	fmt.Println("::group::" + group)
+	fmt.Println(groupStart)
 
 	err := work()
 
-	fmt.Println("::endgroup::")
+	fmt.Println(groupEnd())
 
 	return err
 }
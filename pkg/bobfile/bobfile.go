@@ -7,6 +7,11 @@ import (
 	"io"
 	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
 
 	. "github.com/function61/gokit/builtin"
 	"github.com/function61/gokit/encoding/jsonfile"
@@ -23,17 +28,18 @@ const (
 )
 
 type Bobfile struct {
-	Schema                     string            `json:"$schema"`                                     // JSON schema URL
-	FileDescriptionBoilerplate string            `json:"for_description_of_this_file_see"`            // link which explains what this file is about
-	VersionMajor               int               `json:"version_major"`                               // major version, for indicating backwards-incompatible version breaks
-	ProjectName                string            `json:"project_name"`                                // the project's name, prefer filesystem-safe & URL-safe characters
-	Meta                       ProjectMetadata   `json:"meta,omitempty"`                              // metadata about this project
-	Builders                   []BuilderSpec     `json:"builders"`                                    // builders used to build components of this project
-	DockerImages               []DockerImageSpec `json:"docker_images,omitempty"`                     // container images to build during the build
-	Subrepos                   []SubrepoSpec     `json:"subrepos,omitempty"`                          // subrepos to check out
-	OsArches                   *OsArchesSpec     `json:"os_arches,omitempty"`                         // operating systems and CPU architectures to build for
-	Experiments                experiments       `json:"experiments_i_consent_to_breakage,omitempty"` // unstable experiments to enable. by defining any of these, you consent to your builds breaking on new versions of Turbo Bob.
-	Deprecated1                string            `json:"project_emoji_icon,omitempty"`                // moved to `ProjectMetadata`
+	Schema                     string             `json:"$schema"`                                     // JSON schema URL
+	FileDescriptionBoilerplate string             `json:"for_description_of_this_file_see"`            // link which explains what this file is about
+	VersionMajor               int                `json:"version_major"`                               // major version, for indicating backwards-incompatible version breaks
+	ProjectName                string             `json:"project_name"`                                // the project's name, prefer filesystem-safe & URL-safe characters
+	Meta                       ProjectMetadata    `json:"meta,omitempty"`                              // metadata about this project
+	Builders                   []BuilderSpec      `json:"builders"`                                    // builders used to build components of this project
+	DockerImages               []DockerImageSpec  `json:"docker_images,omitempty"`                     // container images to build during the build
+	Subrepos                   []SubrepoSpec      `json:"subrepos,omitempty"`                          // subrepos to check out
+	OsArches                   *OsArchesSpec      `json:"os_arches,omitempty"`                         // operating systems and CPU architectures to build for
+	GitHubRelease              *GitHubReleaseSpec `json:"github_release,omitempty"`                    // publish collected artefacts to GitHub Releases
+	Experiments                experiments        `json:"experiments_i_consent_to_breakage,omitempty"` // unstable experiments to enable. by defining any of these, you consent to your builds breaking on new versions of Turbo Bob.
+	Deprecated1                string             `json:"project_emoji_icon,omitempty"`                // moved to `ProjectMetadata`
 }
 
 func (b Bobfile) ProjectEmojiIcon() string {
@@ -50,7 +56,13 @@ type ProjectMetadata struct {
 // when experiments are removed or graduated to production, they will be removed from here
 // (yielding unknown field error) and breaking the build. the price of opting in to unstable stuff.
 type experiments struct {
-	PrepareStep bool `json:"prepare_step,omitempty"`
+	PrepareStep      bool `json:"prepare_step,omitempty"`
+	ParallelBuilders bool `json:"parallel_builders,omitempty"` // run independent builders concurrently (see `BuilderSpec.DependsOn`)
+}
+
+type GitHubReleaseSpec struct {
+	Repository string `json:"repository,omitempty" jsonschema:"example=function61/turbobob"` // "owner/repo". defaults to $GITHUB_REPOSITORY (available in GitHub Actions)
+	Prerelease bool   `json:"prerelease,omitempty"`                                          // mark the release as non-production ready
 }
 
 type SubrepoSpec struct {
@@ -129,6 +141,12 @@ func (o *OsArchesSpec) AsBuildEnvVariables() []string {
 		  so backend build can use stuff from documentation.prepare step.
 		- you'll want to publish artefacts only if all builders succeeded (*.build before *.publish),
 		  so there's no unnecessary uploads.
+
+		With the `parallel_builders` experiment the passes are still run in the above order, but
+		inside a pass builders run concurrently unless they declare a dependency on another
+		builder with `depends_on`. Example: documentation.build and frontend.build can run at the
+		same time, but if backend depends on documentation, backend.build starts only after
+		documentation.build has finished.
 */
 type BuilderCommands struct {
 	Prepare []string `json:"prepare,omitempty"` // command for preparing the build
@@ -148,22 +166,45 @@ type BuilderSpec struct {
 	DevHTTPIngress   string            `json:"dev_http_ingress,omitempty" jsonschema:"example=80"`
 	DevProTips       []string          `json:"dev_pro_tips,omitempty"`       // pro-tips e.g. commands the user can run inside the builder to lint / launch / etc. the project
 	DevShellCommands []DevShellCommand `json:"dev_shell_commands,omitempty"` // injected as history for quick recall (ctrl + r)
+	DependsOn        []string          `json:"depends_on,omitempty"`         // names of builders whose pass has to complete before this builder's same pass starts
+	Artefacts        []string          `json:"artefacts,omitempty"`          // globs (relative to project root, e.g. "rel/*") of files the build pass produces. they're collected and checksummed.
+	CacheInputs      []string          `json:"cache_inputs,omitempty"`       // globs (relative to project root, e.g. "go.mod") of files the build pass depends on. if given, build pass result is cached. directories match their contents recursively.
+	WatchPaths       []string          `json:"watch_paths,omitempty"`        // paths (relative to project root) whose changes affect this builder, for "$ bob build --changed-since". defaults to `mount_source`.
 	Envs             map[string]string `json:"env,omitempty"`
 	PassEnvs         []string          `json:"pass_envs,omitempty"`
+	SecretEnvs       []string          `json:"secret_envs,omitempty"`       // subset of `pass_envs` whose values are secrets. they're masked from build output.
+	SecretFiles      []SecretFileSpec  `json:"secret_files,omitempty"`      // files (like kubeconfig or `.npmrc`) made available to build containers via tmpfs
 	ContextlessBuild bool              `json:"contextless_build,omitempty"` // (DEPRECATED) build without uploading any files to the build context
 }
 
+// content comes from exactly one of `from_env` or `from_file`
+type SecretFileSpec struct {
+	Path     string `json:"path" jsonschema:"example=/root/.kube/config"` // absolute path inside the container
+	FromEnv  string `json:"from_env,omitempty" jsonschema:"example=KUBECONFIG_CONTENT"`
+	FromFile string `json:"from_file,omitempty" jsonschema:"example=/etc/ci-secrets/signing.key"` // host path. relative paths are relative to project root.
+}
+
 type DevShellCommand struct {
 	Command   string `json:"command"`   // command to run to achieve the specific task
 	Important bool   `json:"important"` // important commands are shown as pro-tips on "$ bob dev"
 }
 
 type DockerImageSpec struct {
-	Image          string   `json:"image" jsonschema:"example=myorg/myproject"`      // image ref (without the tag) to which to push the image
-	DockerfilePath string   `json:"dockerfile_path" jsonschema:"example=Dockerfile"` // where to find the `Dockerfile` from
-	AuthType       *string  `json:"auth_type"`                                       // creds_from_env
-	Platforms      []string `json:"platforms,omitempty"`                             // platforms to build for, in `$ docker build --platform=...` syntax
-	TagLatest      bool     `json:"tag_latest"`                                      // whether to publish the `:latest` tag
+	Image          string            `json:"image" jsonschema:"example=myorg/myproject"`                                    // image ref (without the tag) to which to push the image
+	DockerfilePath string            `json:"dockerfile_path" jsonschema:"example=Dockerfile"`                               // where to find the `Dockerfile` from
+	AuthType       *string           `json:"auth_type"`                                                                     // creds_from_env (default) | creds_from_file | docker_config | github_token
+	AuthFile       string            `json:"auth_file,omitempty"`                                                           // for creds_from_file. file content is "username:password"
+	CredsEnv       string            `json:"creds_env,omitempty" jsonschema:"example=DOCKER_CREDS_GHCR"`                    // for creds_from_env. name of ENV var with "username:password". defaults to DOCKER_CREDS.
+	Platforms      []string          `json:"platforms,omitempty"`                                                           // platforms to build for, in `$ docker build --platform=...` syntax
+	TagLatest      bool              `json:"tag_latest"`                                                                    // whether to publish the `:latest` tag
+	Tags           []string          `json:"tags,omitempty" jsonschema:"example={{.Branch}},example={{.Major}}.{{.Minor}}"` // additional tags as Go templates. see docs for available values.
+	SBOM           bool              `json:"sbom,omitempty"`                                                                // attach SBOM attestation to the pushed image
+	Provenance     string            `json:"provenance,omitempty" jsonschema:"enum=min,enum=max"`                           // attach SLSA provenance attestation (of given detail level) to the pushed image
+	Sign           *ImageSigningSpec `json:"sign,omitempty"`                                                                // sign the pushed image with cosign
+}
+
+type ImageSigningSpec struct {
+	Key string `json:"key" jsonschema:"example=env://COSIGN_PRIVATE_KEY,example=awskms:///alias/image-signing"` // cosign key reference. file paths are relative to project root.
 }
 
 // FIXME: Bobfile should actually be read only after correct
@@ -206,6 +247,10 @@ func Read() (*Bobfile, error) {
 		return withErr(ErrorWrap("validateBuilders", err))
 	}
 
+	if err := validateDockerImages(bobfile); err != nil {
+		return withErr(ErrorWrap("validateDockerImages", err))
+	}
+
 	for _, subrepo := range bobfile.Subrepos {
 		// https://stackoverflow.com/questions/19633763/unmarshaling-json-in-golang-required-field
 		// we cannot even check for empty value in custom type's UnmarshalJSON() because if
@@ -236,6 +281,137 @@ func validateBuilders(bobfile *Bobfile) error {
 		if len(builder.Commands.Prepare) > 0 && !bobfile.Experiments.PrepareStep {
 			return fmt.Errorf("%s: you need to opt-in to prepare_step experiment", builder.Name)
 		}
+
+		if len(builder.DependsOn) > 0 && !bobfile.Experiments.ParallelBuilders {
+			return fmt.Errorf("%s: you need to opt-in to parallel_builders experiment", builder.Name)
+		}
+
+		for _, pattern := range builder.Artefacts {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: artefacts: %s: %w", builder.Name, pattern, err)
+			}
+		}
+
+		for _, watchPath := range builder.WatchPaths {
+			if watchPath == "" || path.IsAbs(watchPath) || strings.HasPrefix(path.Clean(watchPath), "..") {
+				return fmt.Errorf("%s: watch_paths: must be relative to project root: '%s'", builder.Name, watchPath)
+			}
+		}
+
+		for _, secretEnv := range builder.SecretEnvs {
+			if !slices.Contains(builder.PassEnvs, secretEnv) {
+				return fmt.Errorf("%s: secret_envs: not in pass_envs: %s", builder.Name, secretEnv)
+			}
+		}
+
+		for _, secretFile := range builder.SecretFiles {
+			if !path.IsAbs(secretFile.Path) {
+				return fmt.Errorf("%s: secret_files: path must be absolute: '%s'", builder.Name, secretFile.Path)
+			}
+
+			if (secretFile.FromEnv == "") == (secretFile.FromFile == "") {
+				return fmt.Errorf("%s: secret_files: %s: specify exactly one of from_env or from_file", builder.Name, secretFile.Path)
+			}
+		}
+
+		for _, pattern := range builder.CacheInputs {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%s: cache_inputs: %s: %w", builder.Name, pattern, err)
+			}
+		}
+
+		// cache hit restores only artefacts, so without them the build's outputs would be missing
+		if len(builder.CacheInputs) > 0 && len(builder.Artefacts) == 0 {
+			return fmt.Errorf("%s: cache_inputs: requires artefacts", builder.Name)
+		}
+	}
+
+	for _, builder := range bobfile.Builders {
+		for _, dependency := range builder.DependsOn {
+			if _, exists := alreadySeenNames[dependency]; !exists {
+				return fmt.Errorf("%s: depends_on unknown builder: %s", builder.Name, dependency)
+			}
+		}
+	}
+
+	return validateNoDependencyCycles(bobfile.Builders)
+}
+
+// values available to docker_images[].tags templates. not every value is available for every build.
+var DockerImageTagTemplateKeys = []string{"FriendlyRevisionID", "RevisionID", "RevisionIDShort", "Branch", "Tag", "SemverFromTag", "Major", "Minor", "Patch"}
+
+func validateDockerImages(bobfile *Bobfile) error {
+	// every value present, so executing a template fails only if it refers to an unknown key
+	tagTemplateData := map[string]string{}
+	for _, key := range DockerImageTagTemplateKeys {
+		tagTemplateData[key] = "x"
+	}
+
+	for _, dockerImage := range bobfile.DockerImages {
+		switch dockerImage.Provenance {
+		case "", "min", "max":
+		default:
+			return fmt.Errorf("%s: provenance: must be min or max, got: %s", dockerImage.Image, dockerImage.Provenance)
+		}
+
+		for _, tagTemplate := range dockerImage.Tags {
+			tmpl, err := template.New("").Option("missingkey=error").Parse(tagTemplate)
+			if err != nil {
+				return fmt.Errorf("%s: tags: %w", dockerImage.Image, err)
+			}
+
+			if err := tmpl.Execute(io.Discard, tagTemplateData); err != nil {
+				return fmt.Errorf("%s: tags: %w (available: %s)", dockerImage.Image, err, strings.Join(DockerImageTagTemplateKeys, ", "))
+			}
+		}
+
+		if dockerImage.Sign != nil && dockerImage.Sign.Key == "" {
+			return fmt.Errorf("%s: sign: key required", dockerImage.Image)
+		}
+	}
+
+	return nil
+}
+
+func validateNoDependencyCycles(builders []BuilderSpec) error {
+	dependsOn := map[string][]string{}
+	for _, builder := range builders {
+		dependsOn[builder.Name] = builder.DependsOn
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+
+	state := map[string]int{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+
+		state[name] = visiting
+
+		for _, dependency := range dependsOn[name] {
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+
+		state[name] = visited
+
+		return nil
+	}
+
+	for _, builder := range builders {
+		if err := visit(builder.Name, nil); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -24,6 +24,11 @@ func (h *Hash) String() string {
 	return fmt.Sprintf("%s:%x", h.alg, h.digest)
 }
 
+// digest without the algorithm prefix, like in `sha256sum` output
+func (h *Hash) HexDigest() string {
+	return fmt.Sprintf("%x", h.digest)
+}
+
 func (h *Hash) Equal(other *Hash) bool {
 	return h.alg == other.alg && bytes.Equal(h.digest, other.digest)
 }
@@ -59,4 +59,7 @@ func TestSha256(t *testing.T) {
 
 	//nolint:staticcheck // cannot upgrade to generics yet
 	assert.EqualString(t, th.String(), "sha256:d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592")
+
+	//nolint:staticcheck // cannot upgrade to generics yet
+	assert.EqualString(t, th.HexDigest(), "d7a8fbb307d7809469ca9abcb0082e4f8d5651e46d3cdb762d02d0bf37c9e592")
 }
@@ -3,13 +3,20 @@ package versioncontrol
 import (
 	"strings"
 	"time"
+
+	"github.com/function61/turbobob/pkg/typeddigest"
 )
 
 type Git struct {
 	dir string
 }
 
+// falls back to pure-Go implementation if `git` binary is not available
 func NewGit(dir string) Interface {
+	if !gitBinaryAvailable() {
+		return NewGoGit(dir)
+	}
+
 	return &Git{dir: dir}
 }
 
@@ -52,3 +59,100 @@ func (g *Git) Update(revision string) error {
 	_, err := execWithDir(g.dir, "git", "checkout", "--force", revision)
 	return err
 }
+
+func (g *Git) ChangedFiles(from string, to string) ([]string, error) {
+	// without renames detection a rename shows up as both paths (old deleted, new added)
+	args := []string{"git", "diff", "--name-only", "--no-renames", "-z", from}
+	if to != "" {
+		args = append(args, to)
+	}
+
+	output, err := execWithDir(g.dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if to != "" {
+		return splitNulSeparated(output), nil
+	}
+
+	// new files (not yet committed) are changes too, but `$ git diff` doesn't show them
+	untracked, err := execWithDir(g.dir, "git", "ls-files", "--others", "--exclude-standard", "--full-name", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(splitNulSeparated(output), splitNulSeparated(untracked)...), nil
+}
+
+func (g *Git) CurrentBranch() (string, error) {
+	output, err := execWithDir(g.dir, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	branch := strings.TrimSpace(output)
+	if branch == "HEAD" { // detached
+		return "", nil
+	}
+
+	return branch, nil
+}
+
+func (g *Git) TagsAtHead() ([]string, error) {
+	output, err := execWithDir(g.dir, "git", "tag", "--points-at", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	return strings.Fields(output), nil
+}
+
+func (g *Git) DefaultBranch() (string, error) {
+	// set by `$ git clone`. like "origin/main"
+	if output, err := execWithDir(g.dir, "git", "symbolic-ref", "--quiet", "--short", "refs/remotes/origin/HEAD"); err == nil {
+		return strings.TrimPrefix(strings.TrimSpace(output), "origin/"), nil
+	}
+
+	// no remote (or it was added after cloning) => guess by conventional names
+	for _, candidate := range []string{"main", "master"} {
+		if _, err := execWithDir(g.dir, "git", "rev-parse", "--verify", "--quiet", "refs/heads/"+candidate); err == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (g *Git) UncommittedFiles() ([]string, error) {
+	// staged + unstaged
+	tracked, err := execWithDir(g.dir, "git", "diff", "--name-only", "--no-renames", "-z", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	untracked, err := execWithDir(g.dir, "git", "ls-files", "--others", "--exclude-standard", "--full-name", "-z")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(splitNulSeparated(tracked), splitNulSeparated(untracked)...), nil
+}
+
+func (g *Git) UncommittedChangesDigest() (*typeddigest.Hash, error) {
+	files, err := g.UncommittedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return digestWorkingTreeFiles(g.dir, files)
+}
+
+func (g *Git) ResolveRevision(revision string) (string, error) {
+	output, err := execWithDir(g.dir, "git", "rev-parse", "--verify", "--quiet", revision+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
@@ -0,0 +1,346 @@
+package versioncontrol
+
+// Git support without the `git` binary (minimal CI images etc. don't have it), via go-git library.
+
+import (
+	"errors"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/function61/turbobob/pkg/typeddigest"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+)
+
+type GoGit struct {
+	dir string
+}
+
+func NewGoGit(dir string) Interface {
+	return &GoGit{dir: dir}
+}
+
+var gitBinaryAvailable = sync.OnceValue(func() bool {
+	_, err := exec.LookPath("git")
+	return err == nil
+})
+
+var installInProcessFileTransport = sync.OnceFunc(func() {
+	// go-git's default transport for local repos (which we clone workspaces from) runs `git-upload-pack`
+	client.InstallProtocol("file", server.NewServer(nonBareRepoLoader{}))
+})
+
+// go-git's own `server.DefaultLoader` only understands bare repos
+type nonBareRepoLoader struct{}
+
+func (nonBareRepoLoader) Load(ep *transport.Endpoint) (storer.Storer, error) {
+	repo, err := git.PlainOpen(ep.Path)
+	if err != nil {
+		if errors.Is(err, git.ErrRepositoryNotExists) {
+			return nil, transport.ErrRepositoryNotFound
+		}
+
+		return nil, err
+	}
+
+	return repo.Storer, nil
+}
+
+func (g *GoGit) WithAnotherDir(dir string) Interface {
+	return &GoGit{dir: dir}
+}
+
+func (g *GoGit) VcKind() string {
+	return "git"
+}
+
+func (g *GoGit) Identify() (string, time.Time, error) {
+	repo, err := g.open()
+	if err != nil {
+		return "", zeroTime, err
+	}
+
+	headRef, err := repo.Head()
+	if err != nil {
+		return "", zeroTime, err
+	}
+
+	head, err := repo.CommitObject(headRef.Hash())
+	if err != nil {
+		return "", zeroTime, err
+	}
+
+	// same as `$ git show --format=%ci`
+	return head.Hash.String(), head.Committer.When.UTC(), nil
+}
+
+func (g *GoGit) CloneFrom(source string) error {
+	installInProcessFileTransport()
+
+	_, err := git.PlainClone(g.dir, false, &git.CloneOptions{
+		URL:        source,
+		NoCheckout: true,
+	})
+	return err
+}
+
+func (g *GoGit) Pull() error {
+	installInProcessFileTransport()
+
+	repo, err := g.open()
+	if err != nil {
+		return err
+	}
+
+	// like `$ git fetch`, doesn't touch the working directory
+	if err := repo.Fetch(&git.FetchOptions{}); err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return err
+	}
+
+	return nil
+}
+
+func (g *GoGit) Update(revision string) error {
+	repo, err := g.open()
+	if err != nil {
+		return err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	// `$ git checkout <branch>` switches to the branch instead of detaching
+	if _, err := repo.Reference(plumbing.NewBranchReferenceName(revision), false); err == nil {
+		return worktree.Checkout(&git.CheckoutOptions{
+			Branch: plumbing.NewBranchReferenceName(revision),
+			Force:  true,
+		})
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return err
+	}
+
+	return worktree.Checkout(&git.CheckoutOptions{
+		Hash:  *hash,
+		Force: true,
+	})
+}
+
+func (g *GoGit) ChangedFiles(from string, to string) ([]string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+
+	fromTree, err := revisionTree(repo, from)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := map[string]bool{}
+
+	// working directory is compared in two steps: *from* -> HEAD and HEAD -> working directory
+	toRevision := to
+	if to == "" {
+		toRevision = "HEAD"
+	}
+
+	toTree, err := revisionTree(repo, toRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	// without renames detection a rename shows up as both paths (old deleted, new added)
+	changes, err := object.DiffTree(fromTree, toTree)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		for _, name := range []string{change.From.Name, change.To.Name} {
+			if name != "" {
+				changed[name] = true
+			}
+		}
+	}
+
+	if to == "" {
+		worktree, err := repo.Worktree()
+		if err != nil {
+			return nil, err
+		}
+
+		status, err := worktree.Status()
+		if err != nil {
+			return nil, err
+		}
+
+		for name := range status { // includes untracked files (not ignored ones)
+			changed[name] = true
+		}
+	}
+
+	files := []string{}
+	for name := range changed {
+		files = append(files, name)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func (g *GoGit) CurrentBranch() (string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return "", err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", err
+	}
+
+	if !head.Name().IsBranch() { // detached
+		return "", nil
+	}
+
+	return head.Name().Short(), nil
+}
+
+func (g *GoGit) TagsAtHead() ([]string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	tagRefs, err := repo.Tags()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	if err := tagRefs.ForEach(func(tagRef *plumbing.Reference) error {
+		target := tagRef.Hash()
+		if annotated, err := repo.TagObject(target); err == nil { // lightweight tags point directly to the commit
+			target = annotated.Target
+		}
+
+		if target == head.Hash() {
+			tags = append(tags, tagRef.Name().Short())
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.Strings(tags) // same order as `$ git tag`
+
+	return tags, nil
+}
+
+func (g *GoGit) DefaultBranch() (string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return "", err
+	}
+
+	// set by `$ git clone`. like "origin/main"
+	if originHead, err := repo.Reference(plumbing.NewRemoteHEADReferenceName("origin"), false); err == nil && originHead.Type() == plumbing.SymbolicReference {
+		return strings.TrimPrefix(originHead.Target().Short(), "origin/"), nil
+	}
+
+	// no remote (or it was added after cloning) => guess by conventional names
+	for _, candidate := range []string{"main", "master"} {
+		if _, err := repo.Reference(plumbing.NewBranchReferenceName(candidate), false); err == nil {
+			return candidate, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (g *GoGit) UncommittedFiles() ([]string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return nil, err
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := worktree.Status() // ignored files are left out
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for path, fileStatus := range status {
+		if fileStatus.Staging != git.Unmodified || fileStatus.Worktree != git.Unmodified {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+func (g *GoGit) UncommittedChangesDigest() (*typeddigest.Hash, error) {
+	files, err := g.UncommittedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return digestWorkingTreeFiles(g.dir, files)
+}
+
+func (g *GoGit) ResolveRevision(revision string) (string, error) {
+	repo, err := g.open()
+	if err != nil {
+		return "", err
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return "", err
+	}
+
+	return hash.String(), nil
+}
+
+func (g *GoGit) open() (*git.Repository, error) {
+	// like `git` itself, work also from repo's subdirectories
+	return git.PlainOpenWithOptions(g.dir, &git.PlainOpenOptions{DetectDotGit: true})
+}
+
+func revisionTree(repo *git.Repository, revision string) (*object.Tree, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return commit.Tree()
+}
@@ -0,0 +1,171 @@
+package versioncontrol
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/function61/gokit/testing/assert"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestGoGit(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := git.PlainInit(dir, false)
+	assert.Ok(t, err)
+
+	first := testCommit(t, repo, dir, map[string]string{"README.md": "hello", "backend/main.go": "package main"}, time.Date(2025, 7, 18, 12, 5, 0, 0, time.UTC))
+	second := testCommit(t, repo, dir, map[string]string{"backend/main.go": "package main // changed", "docs/index.md": "docs"}, time.Date(2025, 7, 19, 9, 30, 0, 0, time.UTC))
+
+	_, err = repo.CreateTag("v1.0.0", second, &git.CreateTagOptions{Tagger: testSignature(time.Now()), Message: "release"}) // annotated
+	assert.Ok(t, err)
+	_, err = repo.CreateTag("nightly", second, nil) // lightweight
+	assert.Ok(t, err)
+	_, err = repo.CreateTag("v0.9.0", first, nil) // not at HEAD
+	assert.Ok(t, err)
+
+	vc := NewGoGit(dir)
+
+	revisionID, timestamp, err := vc.Identify()
+	assert.Ok(t, err)
+	assert.Equal(t, revisionID, second.String())
+	assert.Equal(t, timestamp.Format(time.RFC3339), "2025-07-19T09:30:00Z")
+
+	branch, err := vc.CurrentBranch()
+	assert.Ok(t, err)
+	assert.Equal(t, branch, "master")
+
+	defaultBranch, err := vc.DefaultBranch()
+	assert.Ok(t, err)
+	assert.Equal(t, defaultBranch, "master")
+
+	tags, err := vc.TagsAtHead()
+	assert.Ok(t, err)
+	assert.Equal(t, strings.Join(tags, ","), "nightly,v1.0.0")
+
+	changedFiles, err := vc.ChangedFiles(first.String(), second.String())
+	assert.Ok(t, err)
+	assert.Equal(t, strings.Join(changedFiles, ","), "backend/main.go,docs/index.md")
+
+	// working directory changes, including untracked files
+	assert.Ok(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello world"), 0600))
+	assert.Ok(t, os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("hi"), 0600))
+
+	changedFiles, err = vc.ChangedFiles(first.String(), "")
+	assert.Ok(t, err)
+	assert.Equal(t, strings.Join(changedFiles, ","), "README.md,backend/main.go,docs/index.md,untracked.txt")
+}
+
+func TestGoGitCloneAndUpdate(t *testing.T) {
+	originDir := t.TempDir()
+
+	origin, err := git.PlainInit(originDir, false)
+	assert.Ok(t, err)
+
+	first := testCommit(t, origin, originDir, map[string]string{"README.md": "first"}, time.Date(2025, 7, 18, 12, 5, 0, 0, time.UTC))
+
+	workspace := NewGoGit(filepath.Join(t.TempDir(), "workspace"))
+	assert.Ok(t, workspace.CloneFrom(originDir)) // local path, like workspaces are cloned from
+
+	second := testCommit(t, origin, originDir, map[string]string{"README.md": "second"}, time.Date(2025, 7, 19, 9, 30, 0, 0, time.UTC))
+
+	assert.Ok(t, workspace.Pull())
+	assert.Ok(t, workspace.Pull()) // already up-to-date is not an error
+
+	for _, revision := range []plumbing.Hash{second, first} {
+		assert.Ok(t, workspace.Update(revision.String()))
+
+		revisionID, _, err := workspace.Identify()
+		assert.Ok(t, err)
+		assert.Equal(t, revisionID, revision.String())
+	}
+
+	readme, err := os.ReadFile(filepath.Join(workspace.(*GoGit).dir, "README.md"))
+	assert.Ok(t, err)
+	assert.Equal(t, string(readme), "first")
+
+	branch, err := workspace.CurrentBranch()
+	assert.Ok(t, err)
+	assert.Equal(t, branch, "") // detached
+}
+
+// writes *files* and commits them
+func testCommit(t *testing.T, repo *git.Repository, dir string, files map[string]string, when time.Time) plumbing.Hash {
+	t.Helper()
+
+	worktree, err := repo.Worktree()
+	assert.Ok(t, err)
+
+	for name, content := range files {
+		assert.Ok(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0700))
+		assert.Ok(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+
+		_, err := worktree.Add(name)
+		assert.Ok(t, err)
+	}
+
+	hash, err := worktree.Commit("commit", &git.CommitOptions{Author: testSignature(when), Committer: testSignature(when)})
+	assert.Ok(t, err)
+
+	return hash
+}
+
+func testSignature(when time.Time) *object.Signature {
+	return &object.Signature{Name: "Joonas", Email: "joonas@example.com", When: when}
+}
+
+func TestUncommittedChangesDigest(t *testing.T) {
+	dir := t.TempDir()
+
+	repo, err := git.PlainInit(dir, false)
+	assert.Ok(t, err)
+
+	testCommit(t, repo, dir, map[string]string{".gitignore": "build/\n", "README.md": "hello", "main.go": "package main"}, time.Date(2025, 7, 18, 12, 5, 0, 0, time.UTC))
+
+	backends := []Interface{NewGoGit(dir)}
+	if gitBinaryAvailable() { // both backends must agree, so the revision ID doesn't depend on which one is used
+		backends = append(backends, &Git{dir: dir})
+	}
+
+	digests := func() []string {
+		t.Helper()
+
+		results := []string{}
+		for _, backend := range backends {
+			digest, err := backend.UncommittedChangesDigest()
+			assert.Ok(t, err)
+
+			results = append(results, digest.String())
+		}
+
+		return results
+	}
+
+	clean := digests()
+
+	assert.Ok(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("hello world"), 0600))
+	assert.Ok(t, os.Remove(filepath.Join(dir, "main.go")))
+	assert.Ok(t, os.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("hi"), 0600))
+
+	dirty := digests()
+	assert.Assert(t, dirty[0] != clean[0])
+
+	// ignored files don't count
+	assert.Ok(t, os.MkdirAll(filepath.Join(dir, "build"), 0700))
+	assert.Ok(t, os.WriteFile(filepath.Join(dir, "build", "app"), []byte("binary"), 0600))
+
+	assert.Equal(t, strings.Join(digests(), " "), strings.Join(dirty, " "))
+
+	for _, digest := range dirty {
+		assert.Equal(t, digest, dirty[0])
+	}
+
+	revisionID, err := CurrentRevisionID(NewGoGit(dir), false)
+	assert.Ok(t, err)
+	assert.Equal(t, revisionID.FriendlyRevisionID, "20250718_1205_"+revisionID.RevisionID[0:8]+"-uncommitted-"+strings.TrimPrefix(dirty[0], "sha256:")[0:8])
+}
@@ -3,6 +3,8 @@ package versioncontrol
 import (
 	"strings"
 	"time"
+
+	"github.com/function61/turbobob/pkg/typeddigest"
 )
 
 type Mercurial struct {
@@ -49,6 +51,95 @@ func (m *Mercurial) Pull() error {
 }
 
 func (m *Mercurial) Update(revision string) error {
-	_, err := execWithDir(m.dir, "hg", "update", "--rev", revision)
+	// like `$ git checkout --force`. without it local changes would be merged (or the update aborted).
+	_, err := execWithDir(m.dir, "hg", "update", "--clean", "--rev", revision)
 	return err
 }
+
+func (m *Mercurial) ChangedFiles(from string, to string) ([]string, error) {
+	// modified, added, removed, deleted (= missing from working directory)
+	args := []string{"hg", "status", "--modified", "--added", "--removed", "--deleted", "--no-status", "--print0", "--rev", from}
+	if to != "" {
+		args = append(args, "--rev", to)
+	} else {
+		args = append(args, "--unknown") // untracked, not ignored
+	}
+
+	output, err := execWithDir(m.dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return splitNulSeparated(output), nil
+}
+
+// active bookmark if there is one (bookmarks are Mercurial's equivalent of Git's branches), otherwise named branch
+func (m *Mercurial) CurrentBranch() (string, error) {
+	output, err := execWithDir(m.dir, "hg", "log", "--rev", ".", "--template", "{ifeq(activebookmark, '', branch, activebookmark)}")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
+
+func (m *Mercurial) TagsAtHead() ([]string, error) {
+	output, err := execWithDir(m.dir, "hg", "log", "--rev", ".", "--template", "{join(tags, '\\n')}")
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for _, tag := range strings.Fields(output) {
+		if tag != "tip" { // not a real tag, just points to the newest revision
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, nil
+}
+
+// "@" is the conventional bookmark for mainline (`$ hg clone` also updates to it)
+func (m *Mercurial) DefaultBranch() (string, error) {
+	output, err := execWithDir(m.dir, "hg", "bookmarks", "--template", "{bookmark}\n")
+	if err != nil {
+		return "", err
+	}
+
+	for _, bookmark := range strings.Fields(output) {
+		if bookmark == "@" {
+			return "@", nil
+		}
+	}
+
+	return "default", nil
+}
+
+func (m *Mercurial) UncommittedFiles() ([]string, error) {
+	// "unknown" = untracked, not ignored
+	output, err := execWithDir(m.dir, "hg", "status", "--modified", "--added", "--removed", "--deleted", "--unknown", "--no-status", "--print0")
+	if err != nil {
+		return nil, err
+	}
+
+	return splitNulSeparated(output), nil
+}
+
+func (m *Mercurial) UncommittedChangesDigest() (*typeddigest.Hash, error) {
+	files, err := m.UncommittedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	return digestWorkingTreeFiles(m.dir, files)
+}
+
+func (m *Mercurial) ResolveRevision(revision string) (string, error) {
+	// revset can match many revisions (like a branch name), in which case Mercurial picks the last one
+	output, err := execWithDir(m.dir, "hg", "log", "--rev", "last("+revision+")", "--template", "{node}")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(output), nil
+}
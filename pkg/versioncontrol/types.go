@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/function61/turbobob/pkg/typeddigest"
 )
 
 var (
@@ -17,7 +19,24 @@ type Interface interface {
 	WithAnotherDir(dir string) Interface
 	CloneFrom(source string) error
 	Pull() error
+	// checks out *revision*, discarding uncommitted changes to tracked files
 	Update(revision string) error
+	// paths (relative to repo root, slash-separated) of files that differ between revisions.
+	// empty *to* compares against the working directory (including untracked files that aren't ignored).
+	ChangedFiles(from string, to string) ([]string, error)
+	// empty if not on a branch (e.g. detached HEAD)
+	CurrentBranch() (string, error)
+	// tags pointing to the currently checked out revision
+	TagsAtHead() ([]string, error)
+	// branch that releases are made from (like "main"). empty if not known.
+	DefaultBranch() (string, error)
+	// changed tracked files + untracked (non-ignored) files, compared to the checked out revision.
+	// paths relative to repo root, slash-separated.
+	UncommittedFiles() ([]string, error)
+	// digest of UncommittedFiles() paths and content
+	UncommittedChangesDigest() (*typeddigest.Hash, error)
+	// full revision ID of a revision expression like tag, branch or (possibly abbreviated) revision ID
+	ResolveRevision(revision string) (string, error)
 }
 
 type RevisionID struct {
@@ -25,6 +44,14 @@ type RevisionID struct {
 	RevisionID         string
 	RevisionIDShort    string
 	FriendlyRevisionID string
+	Branch             string   // empty if not known (e.g. detached HEAD). Mercurial: bookmark or branch
+	DefaultBranch      string   // empty if not known
+	Tags               []string // tags pointing to the revision. empty for uncommitted builds
+}
+
+// whether the revision is on the branch that releases are made from
+func (r RevisionID) IsDefaultBranch() bool {
+	return r.Branch != "" && r.Branch == r.DefaultBranch
 }
 
 type Kind string
@@ -3,6 +3,7 @@ package versioncontrol
 import (
 	"fmt"
 	"os/exec"
+	"strings"
 	"time"
 )
 
@@ -20,3 +21,15 @@ func execWithDir(dir string, args ...string) (string, error) {
 
 	return string(output), nil
 }
+
+// "a\x00b\x00" => ["a", "b"]
+func splitNulSeparated(output string) []string {
+	items := []string{}
+	for _, item := range strings.Split(output, "\x00") {
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -2,10 +2,13 @@ package versioncontrol
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
-	"time"
+	"sort"
 
 	"github.com/function61/gokit/os/osutil"
+	"github.com/function61/turbobob/pkg/typeddigest"
 )
 
 func CurrentRevisionID(vc Interface, onlyCommitted bool) (*RevisionID, error) {
@@ -19,9 +22,35 @@ func CurrentRevisionID(vc Interface, onlyCommitted bool) (*RevisionID, error) {
 	friendlyRevID := revisionTimestamp.Format("20060102_1504") + "_" + revisionIDShort
 
 	if !onlyCommitted {
-		revisionID += "-uncommitted"
-		revisionIDShort += "-uncommitted"
-		friendlyRevID = time.Now().Format("20060102_1504") + "_" + revisionIDShort
+		changesDigest, err := vc.UncommittedChangesDigest()
+		if err != nil {
+			return nil, err
+		}
+
+		// same uncommitted changes => same ID. commit's timestamp (instead of wall clock) keeps it reproducible.
+		suffix := "-uncommitted-" + changesDigest.HexDigest()[0:8]
+
+		revisionID += suffix
+		revisionIDShort += suffix
+		friendlyRevID = revisionTimestamp.Format("20060102_1504") + "_" + revisionIDShort
+	}
+
+	branch, err := vc.CurrentBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	defaultBranch, err := vc.DefaultBranch()
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	if onlyCommitted { // tags don't describe uncommitted changes
+		tags, err = vc.TagsAtHead()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &RevisionID{
@@ -29,6 +58,9 @@ func CurrentRevisionID(vc Interface, onlyCommitted bool) (*RevisionID, error) {
 		RevisionID:         revisionID,
 		RevisionIDShort:    revisionIDShort,
 		FriendlyRevisionID: friendlyRevID,
+		Branch:             branch,
+		DefaultBranch:      defaultBranch,
+		Tags:               tags,
 	}, nil
 }
 
@@ -64,3 +96,69 @@ func DetectForDirectory(dir string) (Interface, error) {
 
 	return nil, ErrVcMechanismNotIdentified
 }
+
+// digest of *paths* (relative to *dir*, slash-separated) and their content. deleted files are part
+// of the digest too, so deleting a file is a different change than leaving it as-is.
+func digestWorkingTreeFiles(dir string, paths []string) (*typeddigest.Hash, error) {
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+
+	// streamed, so large files don't have to fit in memory
+	digestInput, digestInputWriter := io.Pipe()
+	go func() {
+		_ = digestInputWriter.CloseWithError(writeWorkingTreeFiles(digestInputWriter, dir, sorted))
+	}()
+
+	return typeddigest.Sha256(digestInput)
+}
+
+func writeWorkingTreeFiles(output io.Writer, dir string, paths []string) error {
+	for _, path := range paths {
+		fullPath := filepath.Join(dir, filepath.FromSlash(path))
+
+		info, err := os.Lstat(fullPath)
+		switch {
+		case os.IsNotExist(err):
+			_, err = fmt.Fprintf(output, "%s\x00deleted\x00", path)
+		case err != nil:
+			return err
+		case info.Mode()&os.ModeSymlink != 0:
+			err = writeSymlink(output, path, fullPath)
+		case info.IsDir(): // untracked nested repo etc.
+			_, err = fmt.Fprintf(output, "%s\x00dir\x00", path)
+		default:
+			err = writeFile(output, path, fullPath, info.Size())
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeSymlink(output io.Writer, path string, fullPath string) error {
+	target, err := os.Readlink(fullPath)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(output, "%s\x00symlink\x00%s\x00", path, target)
+	return err
+}
+
+func writeFile(output io.Writer, path string, fullPath string, size int64) error {
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// size prefix makes the content boundary unambiguous
+	if _, err := fmt.Fprintf(output, "%s\x00file\x00%d\x00", path, size); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(output, file, size)
+	return err
+}